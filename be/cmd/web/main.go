@@ -21,7 +21,7 @@ func main() {
 
   server := http.Server{
     Addr: ":" + appConfig.Port,
-    Handler: route(),
+    Handler: route(appConfig),
   }
   log.Printf("Start serving on port %s", appConfig.Port)
 
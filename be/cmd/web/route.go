@@ -4,29 +4,88 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/config"
 	"github.com/lambertse/cquan_go_webapp/internal/middleware"
+	"github.com/lambertse/cquan_go_webapp/internal/tracking"
 	handler "github.com/lambertse/cquan_go_webapp/internal/transport/handlers"
+	"github.com/lambertse/cquan_go_webapp/internal/webhook"
 )
 
-func route() http.Handler {
+func route(cfg *config.AppConfig) http.Handler {
   mux := chi.NewRouter()
 
-  fileHanlder := handler.NewFileHandler()
-  sendMailHander := handler.NewSendMailHandler()
-  emailConfigHandler := handler.NewEmailConfigHandler()
+  fileHanlder := handler.NewFileHandler(cfg)
+  webhookDispatcher := webhook.NewDispatcher()
+  tracker := tracking.NewTracker(cfg.TrackingBaseURL, cfg.TrackingSecret)
+  sendMailHander := handler.NewSendMailHandler(cfg, webhookDispatcher, tracker)
+  emailConfigHandler := handler.NewEmailConfigHandler(cfg)
+  webhookHandler := handler.NewWebhookHandler()
+  footerHandler := handler.NewFooterHandler()
+  smimeHandler := handler.NewSMIMEHandler()
+  pgpHandler := handler.NewPGPHandler()
+  campaignHandler := handler.NewCampaignHandler()
+  columnMappingHandler := handler.NewColumnMappingHandler()
+  trackingHandler := handler.NewTrackingHandler(tracker)
 
   // Global middleware
   mux.Use(middleware.CORS)
 
   // Public routes (no authentication required)
   mux.Post("/login", handler.LoginHandler)
+  mux.Get("/t/o/{token}", trackingHandler.TrackOpen)
+  mux.Get("/t/c/{token}", trackingHandler.TrackClick)
 
   // Protected routes (JWT authentication required)
   mux.Group(func(r chi.Router) {
     r.Use(middleware.JWTMiddleware)
     
     r.Post("/upload_file", fileHanlder.SaveFile)
+    r.Post("/receiver-attachments", fileHanlder.SaveReceiverArchive)
+    r.Get("/receiver-attachments/{id}", fileHanlder.GetReceiverArchive)
     r.Post("/send_email", sendMailHander.SendEmail)
+
+    r.Get("/column-mappings", columnMappingHandler.ListColumnMappings)
+    r.Post("/column-mappings", columnMappingHandler.CreateColumnMapping)
+    r.Put("/column-mappings/{id}", columnMappingHandler.UpdateColumnMapping)
+    r.Delete("/column-mappings/{id}", columnMappingHandler.DeleteColumnMapping)
+
+    r.Get("/footer", footerHandler.GetFooter)
+    r.Put("/footer", footerHandler.SaveFooter)
+    r.Delete("/footer", footerHandler.DeleteFooter)
+
+    r.Put("/smime/identity", smimeHandler.SaveIdentity)
+    r.Delete("/smime/identity", smimeHandler.DeleteIdentity)
+    r.Get("/smime/certificates", smimeHandler.ListCertificates)
+    r.Post("/smime/certificates", smimeHandler.SaveCertificates)
+    r.Delete("/smime/certificates/{email}", smimeHandler.DeleteCertificate)
+
+    r.Get("/pgp/keys", pgpHandler.ListKeys)
+    r.Post("/pgp/keys", pgpHandler.SaveKeys)
+    r.Delete("/pgp/keys/{email}", pgpHandler.DeleteKey)
+
+    r.Get("/templates", emailConfigHandler.ListTemplates)
+    r.Post("/templates", emailConfigHandler.CreateTemplate)
+    r.Post("/templates/import", emailConfigHandler.ImportTemplate)
+    r.Get("/templates/{id}", emailConfigHandler.GetTemplate)
+    r.Put("/templates/{id}", emailConfigHandler.UpdateTemplate)
+    r.Delete("/templates/{id}", emailConfigHandler.DeleteTemplate)
+    r.Get("/templates/{id}/versions", emailConfigHandler.ListTemplateVersions)
+    r.Get("/templates/{id}/versions/{version}", emailConfigHandler.GetTemplateVersion)
+    r.Post("/templates/{id}/versions/{version}/restore", emailConfigHandler.RestoreTemplateVersion)
+    r.Get("/templates/{id}/diff", emailConfigHandler.DiffTemplateVersions)
+    // Validation and previews load stored templates by ID
+    r.Post("/email-config/validate", emailConfigHandler.ValidateEmailConfig)
+    r.Post("/email-config/preview", emailConfigHandler.PreviewEmailConfig)
+
+    r.Get("/campaigns", campaignHandler.ListCampaigns)
+    r.Get("/campaigns/{id}", campaignHandler.GetCampaign)
+    r.Post("/campaigns/{id}/send-winner", sendMailHander.SendWinner)
+
+    r.Get("/webhooks", webhookHandler.ListWebhooks)
+    r.Post("/webhooks", webhookHandler.CreateWebhook)
+    r.Put("/webhooks/{id}", webhookHandler.UpdateWebhook)
+    r.Delete("/webhooks/{id}", webhookHandler.DeleteWebhook)
+    r.Get("/webhooks/deliveries/failed", webhookHandler.ListFailedDeliveries)
   })
 
     mux.Post("/email-config", emailConfigHandler.SaveEmailConfig)
@@ -3,20 +3,27 @@ module github.com/lambertse/cquan_go_webapp
 go 1.23.5
 
 require (
+	github.com/ProtonMail/go-crypto v1.5.2
+	github.com/andybalholm/cascadia v1.3.3
 	github.com/go-chi/chi/v5 v5.2.1
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/golang-jwt/jwt/v4 v4.5.0
+	github.com/smallstep/pkcs7 v0.2.3
 	github.com/xuri/excelize/v2 v2.9.1
+	github.com/yuin/goldmark v1.8.6
+	golang.org/x/net v0.42.0
+	golang.org/x/text v0.28.0
 	gopkg.in/mail.v2 v2.3.1
 )
 
 require (
+	github.com/cloudflare/circl v1.6.3 // indirect
 	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.4 // indirect
 	github.com/tiendc/go-deepcopy v1.6.0 // indirect
 	github.com/xuri/efp v0.0.1 // indirect
 	github.com/xuri/nfp v0.0.1 // indirect
-	golang.org/x/crypto v0.38.0 // indirect
-	golang.org/x/net v0.40.0 // indirect
-	golang.org/x/text v0.25.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 )
@@ -0,0 +1,271 @@
+// Package css moves the rules of <style> blocks into the style attributes
+// of the elements they match. Gmail and Outlook drop or ignore much of
+// the CSS in the document head, while inline styles are kept.
+package css
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Selectors that depend on user interaction cannot be inlined
+var dynamicPseudoPattern = regexp.MustCompile(`(?i):(hover|active|focus|focus-within|focus-visible|visited|target)\b`)
+
+var documentPattern = regexp.MustCompile(`(?i)<(html|body)\b`)
+
+// unsupportedProperties are ignored by at least one major mail client.
+var unsupportedProperties = map[string]string{
+	"position":   "Gmail and Outlook",
+	"float":      "Outlook",
+	"transform":  "Gmail and Outlook",
+	"animation":  "most mail clients",
+	"transition": "most mail clients",
+	"box-shadow": "Outlook",
+	"z-index":    "Gmail and Outlook",
+	"flex":       "Outlook",
+	"grid":       "Gmail and Outlook",
+}
+
+var unsupportedDisplay = map[string]bool{
+	"flex": true, "inline-flex": true, "grid": true, "inline-grid": true,
+}
+
+// Result is the inlined body and what could not be carried over.
+type Result struct {
+	HTML     string   `json:"html"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// match is a declaration applying to an element, with what decides its
+// precedence.
+type match struct {
+	declaration Declaration
+	specificity cascadia.Specificity
+	order       int
+}
+
+// Inline applies the <style> blocks of an HTML body to its elements. Rules
+// that cannot be inlined, such as @media and :hover, stay in a <style>
+// block and are reported as warnings. A body without <style> is returned
+// unchanged.
+func Inline(body string) (*Result, error) {
+	result := &Result{HTML: body}
+	if !strings.Contains(strings.ToLower(body), "<style") {
+		return result, nil
+	}
+
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	warn := func(format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	var styles []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			styles = append(styles, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	matches := make(map[*html.Node][]match)
+	order := 0
+	for _, style := range styles {
+		var sheet strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			sheet.WriteString(c.Data)
+		}
+
+		var kept []string
+		for _, stmt := range parseSheet(sheet.String()) {
+			if stmt.atRule != "" {
+				name := strings.Fields(stmt.atRule)[0]
+				warn("%s rules cannot be inlined and are kept in a <style> block, which some mail clients ignore", strings.TrimRight(name, ";{"))
+				kept = append(kept, stmt.atRule)
+				continue
+			}
+			if dynamicPseudoPattern.MatchString(stmt.selector) {
+				warn("selector %q depends on user interaction and is kept in a <style> block", stmt.selector)
+				kept = append(kept, stmt.selector+" {"+stmt.block+"}")
+				continue
+			}
+			group, err := cascadia.ParseGroupWithPseudoElements(stmt.selector)
+			if err != nil {
+				warn("selector %q is not supported: %v", stmt.selector, err)
+				continue
+			}
+
+			declarations := ParseDeclarations(stmt.block)
+			for _, d := range declarations {
+				warnUnsupported(d, stmt.selector, warn)
+			}
+			for _, sel := range group {
+				if sel.PseudoElement() != "" {
+					warn("selector %q uses the pseudo-element ::%s, which cannot be inlined", stmt.selector, sel.PseudoElement())
+					continue
+				}
+				for _, n := range cascadia.QueryAll(doc, sel) {
+					for _, d := range declarations {
+						matches[n] = append(matches[n], match{declaration: d, specificity: sel.Specificity(), order: order})
+						order++
+					}
+				}
+			}
+		}
+
+		if len(kept) > 0 {
+			for c := style.FirstChild; c != nil; c = style.FirstChild {
+				style.RemoveChild(c)
+			}
+			style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + strings.Join(kept, "\n") + "\n"})
+		} else {
+			style.Parent.RemoveChild(style)
+		}
+	}
+
+	for n, rules := range matches {
+		applyStyles(n, rules, warn)
+	}
+
+	var b strings.Builder
+	if documentPattern.MatchString(body) {
+		err = html.Render(&b, doc)
+	} else {
+		// Keep a fragment a fragment, with any kept <style> in front
+		err = renderFragment(&b, doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render HTML: %w", err)
+	}
+	result.HTML = b.String()
+	result.Warnings = dedupe(result.Warnings)
+	return result, nil
+}
+
+// applyStyles merges the matched rules into the element's style attribute
+// in cascade order: !important first, then the attribute itself, then
+// specificity and source order.
+func applyStyles(n *html.Node, rules []match, warn func(string, ...interface{})) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].specificity != rules[j].specificity {
+			return rules[i].specificity.Less(rules[j].specificity)
+		}
+		return rules[i].order < rules[j].order
+	})
+
+	var own []Declaration
+	attrIndex := -1
+	for i, a := range n.Attr {
+		if a.Key == "style" {
+			own = ParseDeclarations(a.Val)
+			attrIndex = i
+		}
+	}
+
+	values := make(map[string]Declaration)
+	var properties []string
+	set := func(d Declaration) {
+		if existing, ok := values[d.Property]; ok && existing.Important && !d.Important {
+			return
+		}
+		if _, ok := values[d.Property]; !ok {
+			properties = append(properties, d.Property)
+		}
+		values[d.Property] = d
+	}
+	for _, rule := range rules {
+		set(rule.declaration)
+	}
+	for _, d := range own {
+		set(d)
+	}
+
+	inlined := make([]Declaration, 0, len(properties))
+	for _, property := range properties {
+		d := values[property]
+		// Inline, !important only matters against other inline styles
+		d.Important = false
+		inlined = append(inlined, d)
+	}
+
+	style := FormatDeclarations(inlined)
+	if attrIndex >= 0 {
+		n.Attr[attrIndex].Val = style
+	} else {
+		n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+	}
+}
+
+func warnUnsupported(d Declaration, selector string, warn func(string, ...interface{})) {
+	property := d.Property
+	if strings.HasPrefix(property, "grid-") {
+		property = "grid"
+	}
+	if strings.HasPrefix(property, "flex-") {
+		property = "flex"
+	}
+	if clients, ok := unsupportedProperties[property]; ok {
+		warn("%s in %q is not supported by %s", d.Property, selector, clients)
+	}
+	if d.Property == "display" && unsupportedDisplay[strings.ToLower(d.Value)] {
+		warn("display:%s in %q is not supported by Outlook", d.Value, selector)
+	}
+	if strings.Contains(d.Value, "var(") {
+		warn("CSS variables in %q are not supported by Gmail and Outlook", selector)
+	}
+}
+
+// renderFragment writes the head styles and the body contents without the
+// html, head and body elements the parser added.
+func renderFragment(b *strings.Builder, doc *html.Node) error {
+	var head, body *html.Node
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode || n.DataAtom != atom.Html {
+			continue
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Head:
+				head = c
+			case atom.Body:
+				body = c
+			}
+		}
+	}
+	for _, parent := range []*html.Node{head, body} {
+		if parent == nil {
+			continue
+		}
+		for c := parent.FirstChild; c != nil; c = c.NextSibling {
+			if err := html.Render(b, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
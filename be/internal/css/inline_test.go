@@ -0,0 +1,83 @@
+package css
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		warnings []string
+	}{
+		{
+			name: "no style block",
+			body: `<p class="a">Hi</p>`,
+			want: `<p class="a">Hi</p>`,
+		},
+		{
+			name: "class and element rules",
+			body: `<style>p { color: red } .big { font-size: 20px }</style><p class="big">Hi</p>`,
+			want: `<p class="big" style="color:red;font-size:20px">Hi</p>`,
+		},
+		{
+			name: "specificity beats source order",
+			body: `<style>#x { color: blue } p { color: red }</style><p id="x">Hi</p>`,
+			want: `<p id="x" style="color:blue">Hi</p>`,
+		},
+		{
+			name: "style attribute beats rules",
+			body: `<style>p { color: red; margin: 0 }</style><p style="color: green">Hi</p>`,
+			want: `<p style="color:green;margin:0">Hi</p>`,
+		},
+		{
+			name: "important beats style attribute",
+			body: `<style>p { color: red !important }</style><p style="color: green">Hi</p>`,
+			want: `<p style="color:red">Hi</p>`,
+		},
+		{
+			name:     "media rule is kept",
+			body:     `<style>p { color: red } @media (max-width: 600px) { p { color: blue } }</style><p>Hi</p>`,
+			want:     "<style>\n@media (max-width: 600px) { p { color: blue } }\n</style><p style=\"color:red\">Hi</p>",
+			warnings: []string{"@media rules cannot be inlined"},
+		},
+		{
+			name:     "hover rule is kept",
+			body:     `<style>a:hover { color: red }</style><a href="#">x</a>`,
+			want:     "<style>\na:hover { color: red }\n</style><a href=\"#\">x</a>",
+			warnings: []string{`selector "a:hover" depends on user interaction`},
+		},
+		{
+			name:     "unsupported property",
+			body:     `<style>div { display: flex }</style><div>x</div>`,
+			want:     `<div style="display:flex">x</div>`,
+			warnings: []string{"display:flex"},
+		},
+		{
+			name: "document keeps its structure",
+			body: `<html><head><style>p { color: red }</style></head><body><p>Hi</p></body></html>`,
+			want: `<html><head></head><body><p style="color:red">Hi</p></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Inline(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.HTML != tt.want {
+				t.Errorf("HTML = %q, want %q", result.HTML, tt.want)
+			}
+			if len(result.Warnings) != len(tt.warnings) {
+				t.Fatalf("warnings = %q, want %d", result.Warnings, len(tt.warnings))
+			}
+			for i, warning := range tt.warnings {
+				if !strings.Contains(result.Warnings[i], warning) {
+					t.Errorf("warning %q does not mention %q", result.Warnings[i], warning)
+				}
+			}
+		})
+	}
+}
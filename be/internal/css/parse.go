@@ -0,0 +1,143 @@
+package css
+
+import (
+	"strings"
+)
+
+// statement is a rule of a style sheet: either selectors with their
+// declarations, or an at-rule kept as written.
+type statement struct {
+	selector string
+	block    string
+	atRule   string
+}
+
+// Declaration is one property of a rule or style attribute.
+type Declaration struct {
+	Property  string
+	Value     string
+	Important bool
+}
+
+func stripComments(sheet string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(sheet, "/*")
+		if start == -1 {
+			b.WriteString(sheet)
+			return b.String()
+		}
+		b.WriteString(sheet[:start])
+		end := strings.Index(sheet[start+2:], "*/")
+		if end == -1 {
+			return b.String()
+		}
+		sheet = sheet[start+2+end+2:]
+	}
+}
+
+// parseSheet splits a style sheet into its top-level statements. Braces
+// inside strings and nested blocks of at-rules are kept together.
+func parseSheet(sheet string) []statement {
+	sheet = stripComments(sheet)
+
+	var statements []statement
+	var quote byte
+	depth, start, blockStart := 0, 0, -1
+	for i := 0; i < len(sheet); i++ {
+		c := sheet[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';' && depth == 0:
+			// Block-less at-rules such as @import and @charset
+			if text := strings.TrimSpace(sheet[start : i+1]); strings.HasPrefix(text, "@") {
+				statements = append(statements, statement{atRule: text})
+			}
+			start = i + 1
+		case c == '{':
+			if depth == 0 {
+				blockStart = i
+			}
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prelude := strings.TrimSpace(sheet[start:blockStart])
+			if strings.HasPrefix(prelude, "@") {
+				statements = append(statements, statement{atRule: strings.TrimSpace(sheet[start : i+1])})
+			} else if prelude != "" {
+				statements = append(statements, statement{selector: prelude, block: sheet[blockStart+1 : i]})
+			}
+			start = i + 1
+		}
+	}
+	return statements
+}
+
+// ParseDeclarations reads the declarations of a rule block or a style
+// attribute. Semicolons inside strings and parentheses, as in data URLs,
+// do not end a declaration.
+func ParseDeclarations(block string) []Declaration {
+	var declarations []Declaration
+	add := func(text string) {
+		property, value, ok := strings.Cut(text, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !ok || property == "" || value == "" {
+			return
+		}
+		important := false
+		if idx := strings.LastIndex(strings.ToLower(value), "!important"); idx != -1 && strings.TrimSpace(value[idx+len("!important"):]) == "" {
+			important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		declarations = append(declarations, Declaration{Property: property, Value: value, Important: important})
+	}
+
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(block); i++ {
+		c := block[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			add(block[start:i])
+			start = i + 1
+		}
+	}
+	add(block[start:])
+	return declarations
+}
+
+// FormatDeclarations writes declarations back as a style attribute.
+func FormatDeclarations(declarations []Declaration) string {
+	parts := make([]string, 0, len(declarations))
+	for _, d := range declarations {
+		value := d.Value
+		if d.Important {
+			value += " !important"
+		}
+		parts = append(parts, d.Property+":"+value)
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,339 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/lambertse/cquan_go_webapp/internal/format"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/merge"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	fontFamily = "document"
+	fontSize   = 11
+	lineHeight = 6
+)
+
+// Renderer turns document templates into PDF files. It runs entirely
+// offline. Without a TrueType font only Latin-1 characters can be shown,
+// so a Unicode font should be configured for Vietnamese text.
+type Renderer struct {
+	fontPath string
+
+	once sync.Once
+	font []byte
+}
+
+func NewRenderer(fontPath string) *Renderer {
+	return &Renderer{fontPath: fontPath}
+}
+
+func (r *Renderer) loadFont() []byte {
+	r.once.Do(func() {
+		if r.fontPath == "" {
+			return
+		}
+		font, err := os.ReadFile(r.fontPath)
+		if err != nil {
+			log.Printf("Failed to load PDF font %s, falling back to Helvetica: %v", r.fontPath, err)
+			return
+		}
+		r.font = font
+	})
+	return r.font
+}
+
+// Render fills the document template with the receiver's fields and
+// returns the PDF. Dates are shown in the given location. Errors are
+// permanent, rendering the same document again fails the same way.
+func (r *Renderer) Render(doc *model.DocumentTemplate, receiver *model.Receiver, location *time.Location) ([]byte, error) {
+	body, err := executeTemplate(doc, receiver, location)
+	if err != nil {
+		return nil, mailer.Permanent(err)
+	}
+
+	orientation := "P"
+	if strings.EqualFold(doc.Orientation, "landscape") {
+		orientation = "L"
+	}
+	pageSize := doc.PageSize
+	if pageSize == "" {
+		pageSize = "A4"
+	}
+
+	pdf := fpdf.New(orientation, "mm", pageSize, "")
+	w := &writer{pdf: pdf, family: "Helvetica", translate: pdf.UnicodeTranslatorFromDescriptor("")}
+	if font := r.loadFont(); font != nil {
+		for _, style := range []string{"", "B", "I", "BI"} {
+			pdf.AddUTF8FontFromBytes(fontFamily, style, font)
+		}
+		w.family = fontFamily
+		w.translate = func(s string) string { return s }
+	}
+
+	pdf.SetTitle(doc.Title, true)
+	pdf.SetCreator("mail-sender", true)
+	pdf.AddPage()
+
+	if doc.Title != "" {
+		pdf.SetFont(w.family, "B", 16)
+		pdf.MultiCell(0, 9, w.translate(doc.Title), "", "L", false)
+		pdf.Ln(4)
+	}
+	pdf.SetFont(w.family, "", fontSize)
+
+	if doc.Format == model.DocumentFormatHTML {
+		if err := w.writeHTML(body); err != nil {
+			return nil, mailer.Permanent(err)
+		}
+	} else {
+		w.writeText(body)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, mailer.Permanent(fmt.Errorf("failed to render %s: %w", doc.FileName, err))
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, mailer.Permanent(fmt.Errorf("failed to render %s: %w", doc.FileName, err))
+	}
+	return buf.Bytes(), nil
+}
+
+// Check fills the document template without rendering the PDF, and
+// returns the error Render would.
+func Check(doc *model.DocumentTemplate, receiver *model.Receiver, location *time.Location) error {
+	_, err := executeTemplate(doc, receiver, location)
+	return err
+}
+
+// executeTemplate fills the document template. As in the mail body, a
+// missing field is an error rather than "<no value>" in the PDF.
+func executeTemplate(doc *model.DocumentTemplate, receiver *model.Receiver, location *time.Location) (string, error) {
+	funcs := format.Funcs(location)
+	var buf bytes.Buffer
+	if doc.Format == model.DocumentFormatHTML {
+		tmpl, err := htmltemplate.New("document").Funcs(funcs).Option("missingkey=error").Parse(doc.Body)
+		if err != nil {
+			return "", fmt.Errorf("invalid document template %s: %w", doc.FileName, err)
+		}
+		if err := tmpl.Execute(&buf, merge.Data(receiver)); err != nil {
+			return "", fmt.Errorf("failed to fill document %s: %w", doc.FileName, err)
+		}
+		return buf.String(), nil
+	}
+
+	tmpl, err := texttemplate.New("document").Funcs(funcs).Option("missingkey=error").Parse(doc.Body)
+	if err != nil {
+		return "", fmt.Errorf("invalid document template %s: %w", doc.FileName, err)
+	}
+	if err := tmpl.Execute(&buf, merge.Data(receiver)); err != nil {
+		return "", fmt.Errorf("failed to fill document %s: %w", doc.FileName, err)
+	}
+	return buf.String(), nil
+}
+
+type writer struct {
+	pdf       *fpdf.Fpdf
+	family    string
+	translate func(string) string
+	bold      int
+	italic    int
+	underline int
+	size      float64
+}
+
+func (w *writer) setFont() {
+	style := ""
+	if w.bold > 0 {
+		style += "B"
+	}
+	if w.italic > 0 {
+		style += "I"
+	}
+	if w.underline > 0 {
+		style += "U"
+	}
+	size := w.size
+	if size == 0 {
+		size = fontSize
+	}
+	w.pdf.SetFont(w.family, style, size)
+}
+
+// writeText lays out the "text" format line by line.
+func (w *writer) writeText(body string) {
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "---":
+			w.rule()
+		case strings.HasPrefix(trimmed, "## "):
+			w.pdf.SetFont(w.family, "B", 13)
+			w.pdf.MultiCell(0, 8, w.translate(strings.TrimPrefix(trimmed, "## ")), "", "L", false)
+			w.pdf.SetFont(w.family, "", fontSize)
+		case strings.HasPrefix(trimmed, "# "):
+			w.pdf.SetFont(w.family, "B", 15)
+			w.pdf.MultiCell(0, 9, w.translate(strings.TrimPrefix(trimmed, "# ")), "", "L", false)
+			w.pdf.SetFont(w.family, "", fontSize)
+		case trimmed == "":
+			w.pdf.Ln(lineHeight)
+		default:
+			w.pdf.MultiCell(0, lineHeight, w.translate(line), "", "L", false)
+		}
+	}
+}
+
+func (w *writer) rule() {
+	left, _, right, _ := w.pdf.GetMargins()
+	pageWidth, _ := w.pdf.GetPageSize()
+	y := w.pdf.GetY() + 2
+	w.pdf.Line(left, y, pageWidth-right, y)
+	w.pdf.SetY(y + 3)
+}
+
+func (w *writer) writeHTML(body string) error {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to parse document HTML: %w", err)
+	}
+	w.walk(doc)
+	return nil
+}
+
+// newline moves to the next line unless the cursor already is at the start
+// of one.
+func (w *writer) newline() {
+	left, _, _, _ := w.pdf.GetMargins()
+	if w.pdf.GetX() > left+0.1 {
+		w.pdf.Ln(lineHeight)
+	}
+}
+
+func (w *writer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			return
+		}
+		if n.Data[0] == ' ' || n.Data[0] == '\n' {
+			text = " " + text
+		}
+		if last := n.Data[len(n.Data)-1]; last == ' ' || last == '\n' {
+			text += " "
+		}
+		w.pdf.Write(lineHeight, w.translate(text))
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style, atom.Title, atom.Img:
+			return
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		w.pdf.Ln(lineHeight)
+		return
+	case atom.Hr:
+		w.newline()
+		w.rule()
+		return
+	case atom.A:
+		if href := attr(n, "href"); href != "" {
+			w.pdf.SetTextColor(0, 0, 238)
+			w.underline++
+			w.setFont()
+			w.pdf.WriteLinkString(lineHeight, w.translate(textContent(n)), href)
+			w.underline--
+			w.setFont()
+			w.pdf.SetTextColor(0, 0, 0)
+			return
+		}
+	case atom.Center:
+		w.newline()
+		w.pdf.WriteAligned(0, lineHeight, w.translate(strings.Join(strings.Fields(textContent(n)), " ")), "C")
+		w.pdf.Ln(lineHeight)
+		return
+	case atom.B, atom.Strong:
+		w.bold++
+	case atom.I, atom.Em:
+		w.italic++
+	case atom.U:
+		w.underline++
+	case atom.H1, atom.H2, atom.H3, atom.H4:
+		w.newline()
+		w.bold++
+		w.size = map[atom.Atom]float64{atom.H1: 18, atom.H2: 15, atom.H3: 13, atom.H4: 12}[n.DataAtom]
+	case atom.P, atom.Div, atom.Table, atom.Ul, atom.Ol:
+		w.newline()
+	case atom.Tr:
+		w.newline()
+	case atom.Td, atom.Th:
+		w.pdf.Write(lineHeight, "    ")
+	case atom.Li:
+		w.newline()
+		w.pdf.Write(lineHeight, "- ")
+	}
+	w.setFont()
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+
+	switch n.DataAtom {
+	case atom.B, atom.Strong:
+		w.bold--
+	case atom.I, atom.Em:
+		w.italic--
+	case atom.U:
+		w.underline--
+	case atom.H1, atom.H2, atom.H3, atom.H4:
+		w.bold--
+		w.size = 0
+		w.pdf.Ln(lineHeight + 2)
+	case atom.P:
+		w.newline()
+		w.pdf.Ln(lineHeight / 2)
+	case atom.Div, atom.Table, atom.Ul, atom.Ol:
+		w.newline()
+	}
+	w.setFont()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
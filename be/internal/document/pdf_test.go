@@ -0,0 +1,60 @@
+package document
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+func TestRenderErrorsArePermanent(t *testing.T) {
+	renderer := NewRenderer("")
+	receiver := &model.Receiver{Name: "An", TaxID: "0101"}
+
+	tests := []struct {
+		name string
+		doc  model.DocumentTemplate
+	}{
+		{"parse error", model.DocumentTemplate{FileName: "a.pdf", Format: model.DocumentFormatText, Body: "{{.Name"}},
+		{"execute error", model.DocumentTemplate{FileName: "a.pdf", Format: model.DocumentFormatHTML, Body: `{{date "dd/mm/yyyy" .Name}}`}},
+		{"unknown page size", model.DocumentTemplate{FileName: "a.pdf", Format: model.DocumentFormatText, Body: "x", PageSize: "B99"}},
+		{"missing field", model.DocumentTemplate{FileName: "a.pdf", Format: model.DocumentFormatText, Body: "{{.Contract}}"}},
+	}
+	for _, tt := range tests {
+		_, err := renderer.Render(&tt.doc, receiver, time.UTC)
+		if err == nil {
+			t.Errorf("%s: Render succeeded", tt.name)
+			continue
+		}
+		if !mailer.IsPermanent(err) {
+			t.Errorf("%s: IsPermanent(%v) = false", tt.name, err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	doc := model.DocumentTemplate{FileName: "a.pdf", Format: model.DocumentFormatHTML, Body: "<p>Hello <b>{{.Name}}</b></p>"}
+	data, err := NewRenderer("").Render(&doc, &model.Receiver{Name: "An"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Errorf("output is not a PDF: %.20q", data)
+	}
+}
+
+func TestCheckMissingField(t *testing.T) {
+	receiver := &model.Receiver{Name: "An", Fields: map[string]string{"Contract": "HD-1"}}
+	for _, format := range []string{model.DocumentFormatHTML, model.DocumentFormatText} {
+		doc := model.DocumentTemplate{FileName: "a.pdf", Format: format, Body: "{{.Contract}} {{.Amount}}"}
+		if err := Check(&doc, receiver, time.UTC); err == nil {
+			t.Errorf("%s: Check succeeded with a missing field", format)
+		}
+		doc.Body = "{{.Contract}} {{.Name}}"
+		if err := Check(&doc, receiver, time.UTC); err != nil {
+			t.Errorf("%s: Check() = %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package format
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Funcs returns the helper functions available to mail, subject and
+// document templates. Dates without a zone are read, and all dates are
+// shown, in the given location.
+//
+//	{{date "dd/mm/yyyy" .Due}}                     02/11/2026
+//	{{dateIn "Asia/Ho_Chi_Minh" "HH:MI" .Sent}}    14:30
+//	{{vnd .Amount}}                                1.234.567 ₫
+//	{{currency "USD" .Amount}}                     $1,234.57
+//	{{number .Count}}                              12.345
+//	{{formatNumber 2 "," "." .Rate}}               1,234.50
+//	{{upper .Name}} {{lower .Name}} {{title .Name}}
+//	{{.Note | default "none"}}
+func Funcs(location *time.Location) map[string]any {
+	if location == nil {
+		location = time.UTC
+	}
+	return map[string]any{
+		"date": func(layout string, value any) (string, error) {
+			return Date(value, layout, location)
+		},
+		"dateIn": func(timezone, layout string, value any) (string, error) {
+			loc, err := time.LoadLocation(timezone)
+			if err != nil {
+				return "", fmt.Errorf("invalid timezone %q: %w", timezone, err)
+			}
+			return Date(value, layout, loc)
+		},
+		"parseDate": func(layout, value string) (time.Time, error) {
+			return time.ParseInLocation(GoLayout(layout), strings.TrimSpace(value), location)
+		},
+		"now": func() time.Time {
+			return time.Now().In(location)
+		},
+		"number": func(value any) (string, error) {
+			n, err := ParseNumber(value)
+			if err != nil {
+				return "", err
+			}
+			return Number(n, -1, ".", ","), nil
+		},
+		"formatNumber": func(decimals int, thousands, decimal string, value any) (string, error) {
+			n, err := ParseNumber(value)
+			if err != nil {
+				return "", err
+			}
+			return Number(n, decimals, thousands, decimal), nil
+		},
+		"vnd": func(value any) (string, error) {
+			return Currency("VND", value)
+		},
+		"currency": Currency,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"title": func(s string) string {
+			return cases.Title(language.Und).String(strings.ToLower(s))
+		},
+		"trim":    strings.TrimSpace,
+		"default": Default,
+	}
+}
+
+// Default returns value unless it is empty or blank, and fallback then.
+func Default(fallback, value any) any {
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return fallback
+		}
+	}
+	return value
+}
+
+var layoutTokens = regexp.MustCompile(`(?i)yyyy|yy|mm|dd|hh|mi|ss`)
+
+// GoLayout turns a layout such as "dd/mm/yyyy HH:MI" into a Go layout.
+// Tokens are case-insensitive: yyyy, yy, mm (month), dd, hh (24-hour), mi
+// (minute) and ss. Layouts already written the Go way are kept.
+func GoLayout(layout string) string {
+	if strings.Contains(layout, "2006") || strings.Contains(layout, "15:04") {
+		return layout
+	}
+	return layoutTokens.ReplaceAllStringFunc(layout, func(token string) string {
+		return map[string]string{
+			"yyyy": "2006", "yy": "06", "mm": "01", "dd": "02", "hh": "15", "mi": "04", "ss": "05",
+		}[strings.ToLower(token)]
+	})
+}
+
+// dateLayouts are tried in order when reading a date from a sheet. Slashes
+// are read day first as written in Vietnam, "01-02-06" is how Excel shows
+// its default date format.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"2/1/2006",
+	"02-01-2006",
+	"01-02-06",
+}
+
+// ParseDate reads a date given as a time, a date string or an Excel serial
+// number.
+func ParseDate(value any, location *time.Location) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int:
+		return excelDate(float64(v), location)
+	case float64:
+		return excelDate(v, location)
+	case string:
+		s := strings.TrimSpace(v)
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, location); err == nil {
+				return t, nil
+			}
+		}
+		if serial, err := strconv.ParseFloat(s, 64); err == nil && serial > 0 {
+			return excelDate(serial, location)
+		}
+		return time.Time{}, fmt.Errorf("cannot read %q as a date", v)
+	}
+	return time.Time{}, fmt.Errorf("cannot read %v as a date", value)
+}
+
+// excelDate converts an Excel serial number. Serials have no zone, they
+// are local to the sheet.
+func excelDate(serial float64, location *time.Location) (time.Time, error) {
+	t, err := excelize.ExcelDateToTime(serial, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location), nil
+}
+
+// Date formats a date value with a layout such as "dd/mm/yyyy".
+func Date(value any, layout string, location *time.Location) (string, error) {
+	t, err := ParseDate(value, location)
+	if err != nil {
+		return "", err
+	}
+	return t.In(location).Format(GoLayout(layout)), nil
+}
+
+// ParseNumber reads a number given as a Go number or as text. In text, a
+// separator that appears more than once, or a single "." or "," placed as
+// in "1.500", groups thousands; when both "." and "," appear the last one
+// is the decimal separator.
+func ParseNumber(value any) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		s = strings.NewReplacer(" ", "", "\u00a0", "", "₫", "", "đ", "", "$", "", "€", "").Replace(s)
+		dots, commas := strings.Count(s, "."), strings.Count(s, ",")
+		switch {
+		case dots > 0 && commas > 0:
+			if strings.LastIndex(s, ".") > strings.LastIndex(s, ",") {
+				s = strings.ReplaceAll(s, ",", "")
+			} else {
+				s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+			}
+		case dots > 1:
+			s = strings.ReplaceAll(s, ".", "")
+		case commas > 1:
+			s = strings.ReplaceAll(s, ",", "")
+		case dots == 1:
+			s = singleSeparator(s, ".")
+		case commas == 1:
+			s = singleSeparator(s, ",")
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read %q as a number", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("cannot read %v as a number", value)
+}
+
+// singleSeparator reads the only separator of s as grouping thousands when
+// one to three non-zero digits come before it and exactly three after, so
+// "1.500" and "1,500" are 1500, while "0.125", "1234.567" and "1.5" keep
+// their decimals.
+func singleSeparator(s, separator string) string {
+	i := strings.Index(s, separator)
+	whole := strings.TrimLeft(s[:i], "+-")
+	if len(s)-i-1 == 3 && len(whole) <= 3 && strings.Trim(whole, "0") != "" {
+		return strings.Replace(s, separator, "", 1)
+	}
+	return strings.Replace(s, separator, ".", 1)
+}
+
+// Number formats n with grouped thousands. A negative decimals keeps as
+// many decimals as needed.
+func Number(n float64, decimals int, thousands, decimal string) string {
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if n < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+type currencyFormat struct {
+	symbol    string
+	suffix    bool
+	decimals  int
+	thousands string
+	decimal   string
+}
+
+var currencies = map[string]currencyFormat{
+	"VND": {symbol: "₫", suffix: true, decimals: 0, thousands: ".", decimal: ","},
+	"USD": {symbol: "$", decimals: 2, thousands: ",", decimal: "."},
+	"EUR": {symbol: "€", suffix: true, decimals: 2, thousands: ".", decimal: ","},
+	"GBP": {symbol: "£", decimals: 2, thousands: ",", decimal: "."},
+	"JPY": {symbol: "¥", decimals: 0, thousands: ",", decimal: "."},
+	"CNY": {symbol: "¥", decimals: 2, thousands: ",", decimal: "."},
+	"KRW": {symbol: "₩", decimals: 0, thousands: ",", decimal: "."},
+	"SGD": {symbol: "S$", decimals: 2, thousands: ",", decimal: "."},
+	"THB": {symbol: "฿", decimals: 2, thousands: ",", decimal: "."},
+}
+
+// Currency formats an amount the way it is usually written in the
+// currency, e.g. "1.234.567 ₫" or "$1,234.57".
+func Currency(code string, value any) (string, error) {
+	f, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return "", fmt.Errorf("unknown currency %q", code)
+	}
+	n, err := ParseNumber(value)
+	if err != nil {
+		return "", err
+	}
+
+	amount := Number(n, f.decimals, f.thousands, f.decimal)
+	if f.suffix {
+		return amount + " " + f.symbol, nil
+	}
+	if strings.HasPrefix(amount, "-") {
+		return "-" + f.symbol + amount[1:], nil
+	}
+	return f.symbol + amount, nil
+}
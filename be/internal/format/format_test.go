@@ -0,0 +1,98 @@
+package format
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in      any
+		want    float64
+		wantErr bool
+	}{
+		{12, 12, false},
+		{int64(7), 7, false},
+		{1.25, 1.25, false},
+		{"1500", 1500, false},
+		{"1.500", 1500, false},
+		{"1.500 ₫", 1500, false},
+		{"1.234", 1234, false},
+		{"1,500", 1500, false},
+		{"-1.500", -1500, false},
+		{"1.234.567", 1234567, false},
+		{"1,234,567", 1234567, false},
+		{"1.234.567,89", 1234567.89, false},
+		{"1,234,567.89", 1234567.89, false},
+		{"1.5", 1.5, false},
+		{"1,5", 1.5, false},
+		{"12.50", 12.5, false},
+		{"0.125", 0.125, false},
+		{"0,125", 0.125, false},
+		{".125", 0.125, false},
+		{"1.2345", 1.2345, false},
+		{"$1,234.57", 1234.57, false},
+		{" 2 500 000 đ ", 2500000, false},
+		{"1 000", 1000, false},
+		{"abc", 0, true},
+		{"", 0, true},
+		{true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseNumber(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNumber(%#v) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseNumber(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	tests := []struct {
+		code  string
+		value any
+		want  string
+	}{
+		{"VND", "1.500 ₫", "1.500 ₫"},
+		{"vnd", "1.234", "1.234 ₫"},
+		{"VND", 1234567, "1.234.567 ₫"},
+		{"USD", "1234.567", "$1,234.57"},
+		{"USD", "1.500", "$1,500.00"},
+		{"EUR", "1.234,5", "1.234,50 €"},
+	}
+	for _, tt := range tests {
+		got, err := Currency(tt.code, tt.value)
+		if err != nil {
+			t.Errorf("Currency(%q, %#v): %v", tt.code, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Currency(%q, %#v) = %q, want %q", tt.code, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateExcelSerial(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+
+	want := time.Date(2023, time.March, 15, 0, 0, 0, 0, newYork)
+	for _, value := range []any{45000, 45000.0, "45000"} {
+		got, err := ParseDate(value, newYork)
+		if err != nil {
+			t.Errorf("ParseDate(%#v): %v", value, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseDate(%#v) = %v, want %v", value, got, want)
+		}
+		if s, _ := Date(value, "dd/mm/yyyy", newYork); s != "15/03/2023" {
+			t.Errorf("Date(%#v) = %q, want 15/03/2023", value, s)
+		}
+	}
+}
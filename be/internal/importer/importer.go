@@ -0,0 +1,276 @@
+// Package importer turns saved emails into templates: .eml files with
+// their bodies and attachments, and plain .html files.
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Nested multiparts deeper than this are not followed
+const maxDepth = 10
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Import parses the file as a MIME message or an HTML page, depending on
+// its extension. Files without a known extension are sniffed. The
+// warnings list what was left out of the template.
+func Import(filename string, data []byte) (*model.EmailConfig, []string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".eml", ".mht", ".mhtml":
+		return ImportEML(data)
+	case ".html", ".htm":
+		config, err := ImportHTML(data)
+		return config, nil, err
+	case ".msg":
+		// Outlook's own format is not MIME
+		return nil, nil, fmt.Errorf("Outlook .msg files are not supported, save the message as .eml")
+	}
+
+	if looksLikeHTML(data) {
+		config, err := ImportHTML(data)
+		return config, nil, err
+	}
+	return ImportEML(data)
+}
+
+func looksLikeHTML(data []byte) bool {
+	head := strings.ToLower(strings.TrimSpace(string(data[:min(len(data), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") ||
+		strings.HasPrefix(head, "<body") || strings.HasPrefix(head, "<div") || strings.HasPrefix(head, "<table")
+}
+
+// ImportHTML uses the page as the body and its <title> as the subject.
+func ImportHTML(data []byte) (*model.EmailConfig, error) {
+	reader, err := charset.NewReader(bytes.NewReader(data), "text/html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect the character set: %w", err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTML: %w", err)
+	}
+
+	return &model.EmailConfig{
+		Subject:     htmlTitle(string(body)),
+		Body:        string(body),
+		ContentType: model.ContentTypeHTML,
+	}, nil
+}
+
+func htmlTitle(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var title string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if title != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Title && n.FirstChild != nil {
+			title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return title
+}
+
+// ImportEML reads the subject, the HTML or else the text body, and the
+// attachments of a MIME message. Inline images keep their Content-ID so
+// the cid: references of the HTML body still resolve. A text body next to
+// the HTML one is left out and reported in the warnings.
+func ImportEML(data []byte) (*model.EmailConfig, []string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	subject, err := wordDecoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	p := &parser{}
+	if err := p.walk(textproto.MIMEHeader(msg.Header), msg.Body, 0); err != nil {
+		return nil, nil, err
+	}
+
+	config := &model.EmailConfig{
+		Subject:     strings.TrimSpace(subject),
+		Body:        p.text,
+		ContentType: model.ContentTypeText,
+		Attachments: p.attachments,
+	}
+	var warnings []string
+	if p.html != "" {
+		// The text alternative is generated from the HTML when sending
+		if strings.TrimSpace(p.text) != "" {
+			warnings = append(warnings, "the plain text version of the message was not imported, it is generated from the HTML body when sending")
+		}
+		config.Body = p.html
+		config.ContentType = model.ContentTypeHTML
+	}
+	if config.Body == "" && len(config.Attachments) == 0 {
+		return nil, nil, fmt.Errorf("message has no body or attachments")
+	}
+	return config, warnings, nil
+}
+
+type parser struct {
+	html        string
+	text        string
+	attachments []model.Attachment
+}
+
+func (p *parser) walk(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth {
+			return fmt.Errorf("message is nested too deeply")
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read message part: %w", err)
+			}
+			if err := p.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("failed to decode message part: %w", err)
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	isAttachment := disposition == "attachment" || dispositionParams["filename"] != ""
+	switch {
+	case mediaType == "text/html" && !isAttachment && p.html == "":
+		text, err := decodeCharset(data, params["charset"])
+		if err != nil {
+			return err
+		}
+		p.html = text
+	case mediaType == "text/plain" && !isAttachment && p.text == "":
+		text, err := decodeCharset(data, params["charset"])
+		if err != nil {
+			return err
+		}
+		p.text = text
+	default:
+		p.addAttachment(header, mediaType, params, disposition, dispositionParams, data)
+	}
+	return nil
+}
+
+func (p *parser) addAttachment(header textproto.MIMEHeader, mediaType string, params map[string]string, disposition string, dispositionParams map[string]string, data []byte) {
+	name := dispositionParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if decoded, err := wordDecoder.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" || name == "." || name == "/" {
+		name = fmt.Sprintf("attachment-%d", len(p.attachments)+1)
+		if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+			name += extensions[0]
+		}
+	}
+
+	contentID := strings.Trim(strings.TrimSpace(header.Get("Content-Id")), "<>")
+	p.attachments = append(p.attachments, model.Attachment{
+		Name:      name,
+		Type:      mediaType,
+		Size:      int64(len(data)),
+		Data:      "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data),
+		Inline:    contentID != "" && disposition != "attachment",
+		ContentID: contentID,
+	})
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// Line breaks are not part of the alphabet
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+func decodeCharset(data []byte, name string) (string, error) {
+	if name == "" || strings.EqualFold(name, "utf-8") || strings.EqualFold(name, "us-ascii") {
+		return string(data), nil
+	}
+	reader, err := charsetReader(name, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s text: %w", name, err)
+	}
+	return string(decoded), nil
+}
+
+func charsetReader(name string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported character set %s", name)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
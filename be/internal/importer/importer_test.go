@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+const alternativeMessage = "Subject: =?utf-8?q?Xin_ch=C3=A0o?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Hello\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Hello</p>\r\n" +
+	"--b1--\r\n"
+
+const textMessage = "Subject: Hello\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Hello\r\n"
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name        string
+		filename    string
+		data        string
+		subject     string
+		body        string
+		contentType string
+		warnings    int
+	}{
+		{"html and text", "mail.eml", alternativeMessage, "Xin chào", "<p>Hello</p>", model.ContentTypeHTML, 1},
+		{"text only", "mail.eml", textMessage, "Hello", "Hello\r\n", model.ContentTypeText, 0},
+		{"sniffed message", "mail", textMessage, "Hello", "Hello\r\n", model.ContentTypeText, 0},
+		{"html page", "page.html", "<html><head><title>Hi there</title></head><body>x</body></html>", "Hi there", "<html><head><title>Hi there</title></head><body>x</body></html>", model.ContentTypeHTML, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, warnings, err := Import(tt.filename, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Subject != tt.subject || config.Body != tt.body || config.ContentType != tt.contentType {
+				t.Errorf("config = %q %q %q, want %q %q %q", config.Subject, config.Body, config.ContentType, tt.subject, tt.body, tt.contentType)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestImportRejectsOutlookMessages(t *testing.T) {
+	_, _, err := Import("mail.msg", []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"))
+	if err == nil || !strings.Contains(err.Error(), ".msg") {
+		t.Fatalf("err = %v", err)
+	}
+}
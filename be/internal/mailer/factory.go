@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/lambertse/cquan_go_webapp/internal/config"
+)
+
+// NewTransportFromConfig builds the configured transport. The SMTP
+// transport authenticates as the user given to each Send, the HTTP API
+// transports use the provider credentials from the config.
+func NewTransportFromConfig(cfg *config.AppConfig) (Transport, error) {
+	primary, err := newTransport(cfg, cfg.MailTransport)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MailFallbackTransport == "" || cfg.MailFallbackTransport == cfg.MailTransport {
+		return primary, nil
+	}
+
+	secondary, err := newTransport(cfg, cfg.MailFallbackTransport)
+	if err != nil {
+		return nil, err
+	}
+	return NewFailoverTransport(primary, secondary, cfg.FailoverThreshold, cfg.FailoverCooldown), nil
+}
+
+func newTransport(cfg *config.AppConfig, name string) (Transport, error) {
+	switch name {
+	case "", "smtp":
+		return NewSMTPTransport(cfg.SMTPHost, cfg.SMTPPort), nil
+	case "sendgrid":
+		if cfg.SendGridAPIKey == "" {
+			return nil, fmt.Errorf("sendgrid transport requires SENDGRID_API_KEY")
+		}
+		return NewSendGridTransport(cfg.SendGridBaseURL, cfg.SendGridAPIKey), nil
+	case "mailgun":
+		if cfg.MailgunAPIKey == "" || cfg.MailgunDomain == "" {
+			return nil, fmt.Errorf("mailgun transport requires MAILGUN_API_KEY and MAILGUN_DOMAIN")
+		}
+		return NewMailgunTransport(cfg.MailgunBaseURL, cfg.MailgunDomain, cfg.MailgunAPIKey), nil
+	case "ses":
+		if cfg.SESAccessKey == "" || cfg.SESSecretKey == "" {
+			return nil, fmt.Errorf("ses transport requires SES_ACCESS_KEY_ID and SES_SECRET_ACCESS_KEY")
+		}
+		return NewSESTransport(cfg.SESBaseURL, cfg.SESRegion, cfg.SESAccessKey, cfg.SESSecretKey), nil
+	}
+	return nil, fmt.Errorf("unknown mail transport %q", name)
+}
@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// FailoverTransport sends through a primary transport and switches to a
+// secondary one after the primary fails several times in a row. Once the
+// cooldown has passed the primary is tried again.
+type FailoverTransport struct {
+	primary   Transport
+	secondary Transport
+	threshold int
+	cooldown  time.Duration
+
+	mu            sync.Mutex
+	failures      int
+	failoverUntil time.Time
+}
+
+func NewFailoverTransport(primary, secondary Transport, threshold int, cooldown time.Duration) *FailoverTransport {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &FailoverTransport{
+		primary:   primary,
+		secondary: secondary,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (t *FailoverTransport) Name() string {
+	return t.primary.Name() + "+" + t.secondary.Name()
+}
+
+func (t *FailoverTransport) Send(msg *Message, auth Credentials) error {
+	if t.usingSecondary() {
+		return t.secondary.Send(msg, auth)
+	}
+
+	err := t.primary.Send(msg, auth)
+	if err == nil {
+		t.mu.Lock()
+		t.failures = 0
+		t.mu.Unlock()
+		return nil
+	}
+	// A message the provider refuses outright says nothing about its health
+	if IsPermanent(err) {
+		return err
+	}
+
+	t.mu.Lock()
+	t.failures++
+	switched := t.failures >= t.threshold
+	if switched {
+		t.failures = 0
+		t.failoverUntil = time.Now().Add(t.cooldown)
+	}
+	t.mu.Unlock()
+
+	if !switched {
+		return err
+	}
+	log.Printf("Transport %s failed %d times in a row, switching to %s for %s: %v",
+		t.primary.Name(), t.threshold, t.secondary.Name(), t.cooldown, err)
+	return t.secondary.Send(msg, auth)
+}
+
+func (t *FailoverTransport) usingSecondary() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().Before(t.failoverUntil)
+}
@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeTransport records the sends it gets and fails while err is set.
+type fakeTransport struct {
+	name  string
+	err   error
+	sends int
+	auth  Credentials
+}
+
+func (t *fakeTransport) Name() string { return t.name }
+
+func (t *fakeTransport) Send(msg *Message, auth Credentials) error {
+	t.sends++
+	t.auth = auth
+	return t.err
+}
+
+func TestFailoverTransport(t *testing.T) {
+	primary := &fakeTransport{name: "primary", err: errors.New("connection refused")}
+	secondary := &fakeTransport{name: "secondary"}
+	transport := NewFailoverTransport(primary, secondary, 2, 50*time.Millisecond)
+	auth := Credentials{Username: "user@example.com", Password: "token"}
+
+	// The first failure is returned so the caller can retry
+	if err := transport.Send(testMessage(), auth); err == nil {
+		t.Fatal("first send succeeded, want the primary's error")
+	}
+	if secondary.sends != 0 {
+		t.Fatalf("secondary used after %d failure", primary.sends)
+	}
+
+	// The second failure in a row switches over and sends there
+	if err := transport.Send(testMessage(), auth); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+	if secondary.sends != 1 || secondary.auth != auth {
+		t.Fatalf("secondary sends = %d with %+v", secondary.sends, secondary.auth)
+	}
+
+	// The switch sticks for later sends until the cooldown has passed
+	if err := transport.Send(testMessage(), auth); err != nil {
+		t.Fatalf("third send: %v", err)
+	}
+	if primary.sends != 2 || secondary.sends != 2 {
+		t.Fatalf("sends = %d/%d, want 2/2", primary.sends, secondary.sends)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	primary.err = nil
+	if err := transport.Send(testMessage(), auth); err != nil {
+		t.Fatalf("send after cooldown: %v", err)
+	}
+	if primary.sends != 3 || secondary.sends != 2 {
+		t.Fatalf("sends after cooldown = %d/%d, want 3/2", primary.sends, secondary.sends)
+	}
+}
+
+func TestFailoverTransportPermanentError(t *testing.T) {
+	primary := &fakeTransport{name: "primary", err: &SendError{Transport: "primary", StatusCode: 400}}
+	secondary := &fakeTransport{name: "secondary"}
+	transport := NewFailoverTransport(primary, secondary, 1, time.Minute)
+
+	// A rejected message does not count against the primary
+	for i := 0; i < 3; i++ {
+		if err := transport.Send(testMessage(), Credentials{}); !IsPermanent(err) {
+			t.Fatalf("send %d = %v, want the permanent error", i, err)
+		}
+	}
+	if secondary.sends != 0 {
+		t.Errorf("secondary sends = %d, want 0", secondary.sends)
+	}
+}
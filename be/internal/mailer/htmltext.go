@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText renders an HTML body as readable plain text for the
+// text/plain alternative part. Links keep their target in brackets.
+func HTMLToText(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return body
+	}
+
+	w := &textWriter{}
+	w.walk(doc)
+	return w.String()
+}
+
+type textWriter struct {
+	lines   []string
+	current strings.Builder
+}
+
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Table: true, atom.Tr: true,
+	atom.Ul: true, atom.Ol: true, atom.Blockquote: true, atom.Pre: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true,
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.writeText(n.Data)
+		return
+	case html.ElementNode:
+		if skippedElements[n.DataAtom] {
+			return
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		w.newline()
+		return
+	case atom.Hr:
+		w.paragraph()
+		w.current.WriteString("----------------------------------------")
+		w.paragraph()
+		return
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			w.writeText("[" + alt + "]")
+		}
+		return
+	case atom.Li:
+		if w.current.Len() > 0 {
+			w.newline()
+		}
+		w.current.WriteString("- ")
+	case atom.Td, atom.Th:
+		if w.current.Len() > 0 {
+			w.current.WriteString("\t")
+		}
+	}
+
+	if blockElements[n.DataAtom] {
+		w.paragraph()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if blockElements[n.DataAtom] {
+		w.paragraph()
+	}
+
+	if n.DataAtom == atom.A {
+		href := attr(n, "href")
+		if href != "" && !strings.HasPrefix(href, "#") && !strings.Contains(textContent(n), href) {
+			w.writeText(" (" + strings.TrimPrefix(href, "mailto:") + ")")
+		}
+	}
+}
+
+// writeText appends text with HTML whitespace collapsed to single spaces.
+func (w *textWriter) writeText(s string) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" && w.current.Len() > 0 && !strings.HasSuffix(w.current.String(), " ") {
+			w.current.WriteString(" ")
+		}
+		return
+	}
+	if startsWithSpace(s) && w.current.Len() > 0 && !strings.HasSuffix(w.current.String(), " ") {
+		w.current.WriteString(" ")
+	}
+	w.current.WriteString(strings.Join(fields, " "))
+	if startsWithSpace(s[len(s)-1:]) {
+		w.current.WriteString(" ")
+	}
+}
+
+func (w *textWriter) newline() {
+	w.lines = append(w.lines, strings.TrimRight(w.current.String(), " \t"))
+	w.current.Reset()
+}
+
+// paragraph ends the current line and leaves one blank line, without
+// stacking several blank lines for nested block elements.
+func (w *textWriter) paragraph() {
+	if w.current.Len() > 0 {
+		w.newline()
+	}
+	if len(w.lines) > 0 && w.lines[len(w.lines)-1] != "" {
+		w.lines = append(w.lines, "")
+	}
+}
+
+func (w *textWriter) String() string {
+	if w.current.Len() > 0 {
+		w.newline()
+	}
+	return strings.TrimSpace(strings.Join(w.lines, "\n"))
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s[:1], " \t\r\n") == ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const httpTransportTimeout = 30 * time.Second
+
+// maxErrorBody caps how much of a provider's error response is kept
+const maxErrorBody = 1024
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: httpTransportTimeout}
+}
+
+// do sends the request and turns any non 2xx reply into a SendError.
+func do(client *http.Client, transport string, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: request failed: %w", transport, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &SendError{
+			Transport:  transport,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
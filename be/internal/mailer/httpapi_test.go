@@ -0,0 +1,211 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captured is the part of a provider request the tests look at.
+type captured struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+	form   map[string][]string
+	user   string
+	pass   string
+}
+
+func newProvider(t *testing.T, status int, reply string) (*httptest.Server, *captured) {
+	t.Helper()
+	got := &captured{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method = r.Method
+		got.path = r.URL.Path
+		got.header = r.Header.Clone()
+		got.user, got.pass, _ = r.BasicAuth()
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("parse form: %v", err)
+			}
+			got.form = r.MultipartForm.Value
+		} else {
+			got.body, _ = io.ReadAll(r.Body)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(server.Close)
+	return server, got
+}
+
+func testMessage() *Message {
+	return &Message{
+		From:     "sender@example.com",
+		To:       []string{"to@example.com"},
+		Subject:  "Hello",
+		TextBody: "Hi there",
+		HTMLBody: "<p>Hi there</p>",
+	}
+}
+
+func TestSendGridTransport(t *testing.T) {
+	server, got := newProvider(t, http.StatusAccepted, "")
+	transport := NewSendGridTransport(server.URL+"/", "sg-key")
+
+	if err := transport.Send(testMessage(), Credentials{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.method != http.MethodPost || got.path != "/v3/mail/send" {
+		t.Errorf("request = %s %s, want POST /v3/mail/send", got.method, got.path)
+	}
+	if auth := got.header.Get("Authorization"); auth != "Bearer sg-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	var payload sendGridRequest
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if payload.From.Email != "sender@example.com" || payload.Subject != "Hello" {
+		t.Errorf("from/subject = %q/%q", payload.From.Email, payload.Subject)
+	}
+	if len(payload.Personalizations) != 1 || len(payload.Personalizations[0].To) != 1 ||
+		payload.Personalizations[0].To[0].Email != "to@example.com" {
+		t.Errorf("personalizations = %+v", payload.Personalizations)
+	}
+	if len(payload.Content) != 2 || payload.Content[0].Type != "text/plain" || payload.Content[1].Type != "text/html" {
+		t.Errorf("content = %+v, want text/plain then text/html", payload.Content)
+	}
+}
+
+func TestSendGridTransportRejectsRaw(t *testing.T) {
+	transport := NewSendGridTransport("http://127.0.0.1:0", "sg-key")
+	msg := testMessage()
+	msg.Raw = []byte("raw")
+
+	err := transport.Send(msg, Credentials{})
+	if !IsPermanent(err) {
+		t.Errorf("Send raw = %v, want a permanent error", err)
+	}
+}
+
+func TestMailgunTransport(t *testing.T) {
+	server, got := newProvider(t, http.StatusOK, `{"id":"1"}`)
+	transport := NewMailgunTransport(server.URL, "mg.example.com", "mg-key")
+
+	if err := transport.Send(testMessage(), Credentials{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.path != "/v3/mg.example.com/messages" {
+		t.Errorf("path = %q", got.path)
+	}
+	if got.user != "api" || got.pass != "mg-key" {
+		t.Errorf("basic auth = %q:%q", got.user, got.pass)
+	}
+	want := map[string]string{
+		"from":    "sender@example.com",
+		"to":      "to@example.com",
+		"subject": "Hello",
+		"text":    "Hi there",
+		"html":    "<p>Hi there</p>",
+	}
+	for field, value := range want {
+		if values := got.form[field]; len(values) != 1 || values[0] != value {
+			t.Errorf("field %s = %q, want %q", field, values, value)
+		}
+	}
+}
+
+func TestMailgunTransportRaw(t *testing.T) {
+	server, got := newProvider(t, http.StatusOK, `{"id":"1"}`)
+	transport := NewMailgunTransport(server.URL, "mg.example.com", "mg-key")
+	msg := testMessage()
+	msg.Raw = []byte("Subject: signed\r\n\r\nbody")
+
+	if err := transport.Send(msg, Credentials{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.path != "/v3/mg.example.com/messages.mime" {
+		t.Errorf("path = %q", got.path)
+	}
+	if values := got.form["to"]; len(values) != 1 || values[0] != "to@example.com" {
+		t.Errorf("to = %q", values)
+	}
+}
+
+func TestSESTransport(t *testing.T) {
+	server, got := newProvider(t, http.StatusOK, `{"MessageId":"1"}`)
+	transport := NewSESTransport(server.URL, "eu-west-1", "AKID", "secret")
+
+	if err := transport.Send(testMessage(), Credentials{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got.path != "/v2/email/outbound-emails" {
+		t.Errorf("path = %q", got.path)
+	}
+	auth := got.header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(auth, "/eu-west-1/ses/aws4_request") ||
+		!strings.Contains(auth, "Signature=") {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if got.header.Get("X-Amz-Date") == "" {
+		t.Error("X-Amz-Date header is missing")
+	}
+
+	var payload struct {
+		FromEmailAddress string
+		Destination      struct{ ToAddresses []string }
+		Content          struct{ Raw struct{ Data string } }
+	}
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload.Content.Raw.Data)
+	if err != nil {
+		t.Fatalf("raw data is not base64: %v", err)
+	}
+	if !strings.Contains(string(raw), "Subject: Hello") {
+		t.Errorf("raw message has no subject:\n%s", raw)
+	}
+	if len(payload.Destination.ToAddresses) != 1 || payload.Destination.ToAddresses[0] != "to@example.com" {
+		t.Errorf("destination = %v", payload.Destination.ToAddresses)
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusRequestEntityTooLarge, true},
+		{http.StatusUnprocessableEntity, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tt := range tests {
+		server, _ := newProvider(t, tt.status, " provider says no \n")
+		transport := NewSendGridTransport(server.URL, "sg-key")
+
+		err := transport.Send(testMessage(), Credentials{})
+		sendErr, ok := err.(*SendError)
+		if !ok {
+			t.Fatalf("status %d: error = %v, want *SendError", tt.status, err)
+		}
+		if sendErr.StatusCode != tt.status || sendErr.Transport != "sendgrid" || sendErr.Body != "provider says no" {
+			t.Errorf("status %d: error = %+v", tt.status, sendErr)
+		}
+		if IsPermanent(err) != tt.permanent {
+			t.Errorf("status %d: IsPermanent = %v, want %v", tt.status, !tt.permanent, tt.permanent)
+		}
+	}
+}
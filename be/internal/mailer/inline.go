@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var imgSrcPattern = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)("([^"]*)"|'([^']*)')`)
+
+var contentIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// AttachInline adds a file embedded in the HTML body under contentID. An
+// empty contentID is derived from the file name.
+func (m *Message) AttachInline(filename, contentType, contentID string, data []byte) {
+	if contentID == "" {
+		contentID = contentIDUnsafe.ReplaceAllString(filename, "_") + "@mail-sender"
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+		Inline:      true,
+		ContentID:   contentID,
+	})
+}
+
+// LinkInlineImages rewrites <img src> references to inline attachments into
+// cid: URLs so the images render without being fetched from outside. An
+// image matches when its src is the attachment's file name, or a URL whose
+// last path segment is the file name.
+func (m *Message) LinkInlineImages() {
+	if m.HTMLBody == "" {
+		return
+	}
+
+	cids := make(map[string]string)
+	for _, attachment := range m.Attachments {
+		if attachment.Inline {
+			cids[strings.ToLower(attachment.Filename)] = attachment.ContentID
+		}
+	}
+	if len(cids) == 0 {
+		return
+	}
+
+	m.HTMLBody = imgSrcPattern.ReplaceAllStringFunc(m.HTMLBody, func(tag string) string {
+		groups := imgSrcPattern.FindStringSubmatch(tag)
+		src := groups[3] + groups[4]
+		cid, ok := cids[strings.ToLower(inlineName(src))]
+		if !ok {
+			return tag
+		}
+		return fmt.Sprintf(`%s"cid:%s"`, groups[1], cid)
+	})
+}
+
+func inlineName(src string) string {
+	if strings.HasPrefix(src, "cid:") || strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	if parsed, err := url.Parse(src); err == nil {
+		src = parsed.Path
+	}
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	return path.Base(src)
+}
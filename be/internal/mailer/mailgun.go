@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+const defaultMailgunBaseURL = "https://api.mailgun.net"
+
+// MailgunTransport sends mail through a Mailgun style "messages" API.
+type MailgunTransport struct {
+	baseURL string
+	domain  string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewMailgunTransport(baseURL, domain, apiKey string) *MailgunTransport {
+	if baseURL == "" {
+		baseURL = defaultMailgunBaseURL
+	}
+	return &MailgunTransport{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		domain:  domain,
+		apiKey:  apiKey,
+		client:  newHTTPClient(),
+	}
+}
+
+func (t *MailgunTransport) Name() string {
+	return "mailgun"
+}
+
+func (t *MailgunTransport) Send(msg *Message, _ Credentials) error {
+	if msg.Raw != nil {
+		return t.sendMIME(msg)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	fields := [][2]string{
+		{"from", msg.From},
+		{"to", strings.Join(msg.To, ",")},
+		{"subject", msg.Subject},
+	}
+	if msg.TextBody != "" {
+		fields = append(fields, [2]string{"text", msg.TextBody})
+	}
+	if msg.HTMLBody != "" {
+		fields = append(fields, [2]string{"html", msg.HTMLBody})
+	}
+	for key, value := range msg.Headers {
+		fields = append(fields, [2]string{"h:" + key, value})
+	}
+	for _, field := range fields {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return fmt.Errorf("mailgun: failed to encode request: %w", err)
+		}
+	}
+
+	for _, attachment := range msg.Attachments {
+		field, filename := "attachment", attachment.Filename
+		if attachment.Inline {
+			// Mailgun uses the inline file name as its Content-ID
+			field, filename = "inline", attachment.ContentID
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, filename))
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return fmt.Errorf("mailgun: failed to encode attachment %s: %w", attachment.Filename, err)
+		}
+		if _, err := part.Write(attachment.Data); err != nil {
+			return fmt.Errorf("mailgun: failed to encode attachment %s: %w", attachment.Filename, err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("mailgun: failed to encode request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v3/%s/messages", t.baseURL, t.domain)
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return fmt.Errorf("mailgun: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.SetBasicAuth("api", t.apiKey)
+
+	return do(t.client, t.Name(), req)
+}
+
+// sendMIME posts an already encoded message to the "messages.mime" endpoint.
+func (t *MailgunTransport) sendMIME(msg *Message) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("to", strings.Join(msg.To, ",")); err != nil {
+		return fmt.Errorf("mailgun: failed to encode request: %w", err)
+	}
+	part, err := form.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return fmt.Errorf("mailgun: failed to encode request: %w", err)
+	}
+	if _, err := part.Write(msg.Raw); err != nil {
+		return fmt.Errorf("mailgun: failed to encode request: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("mailgun: failed to encode request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v3/%s/messages.mime", t.baseURL, t.domain)
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return fmt.Errorf("mailgun: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.SetBasicAuth("api", t.apiKey)
+
+	return do(t.client, t.Name(), req)
+}
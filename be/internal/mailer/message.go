@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+
+	"gopkg.in/mail.v2"
+)
+
+// Message is a fully rendered email ready to be handed to a Transport.
+type Message struct {
+	From        string
+	To          []string
+	Subject     string
+	Headers     map[string]string
+	TextBody    string
+	HTMLBody    string
+	Attachments []Attachment
+	// Raw holds the final MIME form once a Processor has rewritten the
+	// message. Transports send it as is instead of encoding the fields above.
+	Raw []byte
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Inline      bool
+	ContentID   string
+}
+
+func (m *Message) Attach(filename, contentType string, data []byte) {
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
+// toGomail converts the message into a gomail message for MIME encoding.
+func (m *Message) toGomail() *mail.Message {
+	gm := mail.NewMessage()
+	gm.SetHeader("From", m.From)
+	gm.SetHeader("To", m.To...)
+	gm.SetHeader("Subject", m.Subject)
+	for key, value := range m.Headers {
+		gm.SetHeader(key, value)
+	}
+
+	switch {
+	case m.TextBody != "" && m.HTMLBody != "":
+		gm.SetBody("text/plain", m.TextBody)
+		gm.AddAlternative("text/html", m.HTMLBody)
+	case m.HTMLBody != "":
+		gm.SetBody("text/html", m.HTMLBody)
+	default:
+		gm.SetBody("text/plain", m.TextBody)
+	}
+
+	for _, attachment := range m.Attachments {
+		data := attachment.Data
+		header := map[string][]string{}
+		if attachment.ContentType != "" {
+			header["Content-Type"] = []string{attachment.ContentType + `; name="` + attachment.Filename + `"`}
+		}
+		if attachment.Inline && attachment.ContentID != "" {
+			header["Content-ID"] = []string{"<" + attachment.ContentID + ">"}
+		}
+		settings := []mail.FileSetting{
+			mail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}),
+			mail.SetHeader(header),
+		}
+		if attachment.Inline {
+			// Embedded files end up in a multipart/related part next to the HTML
+			gm.Embed(attachment.Filename, settings...)
+		} else {
+			gm.Attach(attachment.Filename, settings...)
+		}
+	}
+	return gm
+}
+
+// MIME returns the message encoded as an RFC 5322 document.
+func (m *Message) MIME() ([]byte, error) {
+	if m.Raw != nil {
+		return m.Raw, nil
+	}
+	var buf bytes.Buffer
+	if _, err := m.toGomail().WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newBoundaryID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Processor transforms a built message before it is sent, for example to
+// sign or encrypt it. Processors work on the raw MIME form of the message.
+type Processor interface {
+	Process(m *Message) error
+}
+
+// SplitMIME separates a raw message into its envelope header fields (From,
+// To, Subject, ...) and the content entity made of the Content-* header
+// fields and the body. The content entity is what gets signed or
+// encrypted. Line endings are normalized to CRLF.
+func SplitMIME(raw []byte) ([]string, []byte, error) {
+	raw = canonicalLineEndings(raw)
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end == -1 {
+		return nil, nil, fmt.Errorf("message has no header section")
+	}
+
+	var envelope, content []string
+	for _, field := range headerFields(string(raw[:end])) {
+		if strings.HasPrefix(strings.ToLower(field), "content-") {
+			content = append(content, field)
+		} else {
+			envelope = append(envelope, field)
+		}
+	}
+
+	var entity bytes.Buffer
+	for _, field := range content {
+		entity.WriteString(field)
+		entity.WriteString("\r\n")
+	}
+	entity.WriteString("\r\n")
+	entity.Write(raw[end+4:])
+	return envelope, entity.Bytes(), nil
+}
+
+// JoinMIME puts envelope header fields in front of a content entity.
+func JoinMIME(envelope []string, entity []byte) []byte {
+	var buf bytes.Buffer
+	for _, field := range envelope {
+		buf.WriteString(field)
+		buf.WriteString("\r\n")
+	}
+	buf.Write(entity)
+	return buf.Bytes()
+}
+
+// headerFields splits a header block into fields, keeping folded
+// continuation lines with their field.
+func headerFields(block string) []string {
+	var fields []string
+	for _, line := range strings.Split(block, "\r\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(fields) > 0 {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func canonicalLineEndings(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// Base64Lines encodes data as base64 wrapped at 76 characters, as MIME
+// requires.
+func Base64Lines(encoded string) string {
+	var buf strings.Builder
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+	return buf.String()
+}
+
+// Boundary returns a random multipart boundary.
+func Boundary() string {
+	return "----=_Part_" + newBoundaryID()
+}
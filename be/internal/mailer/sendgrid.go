@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultSendGridBaseURL = "https://api.sendgrid.com"
+
+// SendGridTransport sends mail through a SendGrid style v3 "mail/send" API.
+type SendGridTransport struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type sendGridRequest struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From        sendGridAddress      `json:"from"`
+	Subject     string               `json:"subject"`
+	Headers     map[string]string    `json:"headers,omitempty"`
+	Content     []sendGridContent    `json:"content"`
+	Attachments []sendGridAttachment `json:"attachments,omitempty"`
+}
+
+func NewSendGridTransport(baseURL, apiKey string) *SendGridTransport {
+	if baseURL == "" {
+		baseURL = defaultSendGridBaseURL
+	}
+	return &SendGridTransport{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  newHTTPClient(),
+	}
+}
+
+func (t *SendGridTransport) Name() string {
+	return "sendgrid"
+}
+
+func (t *SendGridTransport) Send(msg *Message, _ Credentials) error {
+	if msg.Raw != nil {
+		return fmt.Errorf("sendgrid: %w", ErrRawUnsupported)
+	}
+
+	var payload sendGridRequest
+	payload.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	for _, to := range msg.To {
+		payload.Personalizations[0].To = append(payload.Personalizations[0].To, sendGridAddress{Email: to})
+	}
+	payload.From = sendGridAddress{Email: msg.From}
+	payload.Subject = msg.Subject
+	payload.Headers = msg.Headers
+
+	// SendGrid requires text/plain to come before text/html
+	if msg.TextBody != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: msg.TextBody})
+	}
+	if msg.HTMLBody != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/html", Value: msg.HTMLBody})
+	}
+	if len(payload.Content) == 0 {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: " "})
+	}
+
+	for _, attachment := range msg.Attachments {
+		item := sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(attachment.Data),
+			Filename:    attachment.Filename,
+			Type:        attachment.ContentType,
+			Disposition: "attachment",
+		}
+		if attachment.Inline {
+			item.Disposition = "inline"
+			item.ContentID = attachment.ContentID
+		}
+		payload.Attachments = append(payload.Attachments, item)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("sendgrid: failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.baseURL+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sendgrid: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+
+	return do(t.client, t.Name(), req)
+}
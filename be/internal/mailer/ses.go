@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const sesService = "ses"
+
+// SESTransport sends mail through an SES style v2 "outbound-emails" API.
+// The message is always sent as raw MIME so attachments are preserved.
+type SESTransport struct {
+	baseURL   string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+type sesRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Raw struct {
+			Data []byte `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+func NewSESTransport(baseURL, region, accessKey, secretKey string) *SESTransport {
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://email.%s.amazonaws.com", region)
+	}
+	return &SESTransport{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    newHTTPClient(),
+	}
+}
+
+func (t *SESTransport) Name() string {
+	return "ses"
+}
+
+func (t *SESTransport) Send(msg *Message, _ Credentials) error {
+	raw, err := msg.MIME()
+	if err != nil {
+		return fmt.Errorf("ses: failed to encode message: %w", err)
+	}
+
+	var payload sesRequest
+	payload.FromEmailAddress = msg.From
+	payload.Destination.ToAddresses = msg.To
+	// encoding/json encodes []byte as base64, which is what SES expects
+	payload.Content.Raw.Data = raw
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ses: failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.baseURL+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ses: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	t.sign(req, body, time.Now().UTC())
+
+	return do(t.client, t.Name(), req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to the request.
+func (t *SESTransport) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		req.Header.Get("Content-Type"), req.URL.Host, payloadHash, amzDate)
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, t.region, sesService)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), date)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, sesService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	// url.Values.Encode sorts by key, as SigV4 requires
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
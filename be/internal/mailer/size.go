@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+)
+
+// DefaultMaxMessageSize matches the 25 MB limit of Gmail.
+const DefaultMaxMessageSize = 25 << 20
+
+const zippedAttachmentsName = "attachments.zip"
+
+// SizeError is returned when a message is larger than the size budget.
+type SizeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("message is %s after encoding, which exceeds the %s limit",
+		FormatSize(e.Size), FormatSize(e.Limit))
+}
+
+func FormatSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
+
+// EncodedSize returns the size of the message once MIME encoded, which is
+// what the mail provider counts against its limit.
+func (m *Message) EncodedSize() (int64, error) {
+	raw, err := m.MIME()
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return int64(len(raw)), nil
+}
+
+// FitSize checks the message against the size limit, DefaultMaxMessageSize
+// when the limit is not set. When allowZip is set and the message is too
+// large, the regular attachments are bundled into a single zip first. It
+// returns the final encoded size.
+func (m *Message) FitSize(limit int64, allowZip bool) (int64, error) {
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+	size, err := m.EncodedSize()
+	if err != nil || size <= limit {
+		return size, err
+	}
+
+	// A signed or encrypted message cannot be changed any more
+	if allowZip && m.Raw == nil {
+		zipped, err := m.zipAttachments()
+		if err != nil {
+			return size, err
+		}
+		if zipped {
+			if size, err = m.EncodedSize(); err != nil || size <= limit {
+				return size, err
+			}
+		}
+	}
+	return size, &SizeError{Size: size, Limit: limit}
+}
+
+// zipAttachments replaces the regular attachments with one compressed
+// archive. Inline images stay as they are since the HTML refers to them.
+// It reports false when zipping would not make the message smaller.
+func (m *Message) zipAttachments() (bool, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	var kept []Attachment
+	var original int
+	for _, attachment := range m.Attachments {
+		if attachment.Inline {
+			kept = append(kept, attachment)
+			continue
+		}
+		w, err := archive.Create(attachment.Filename)
+		if err != nil {
+			return false, fmt.Errorf("failed to zip %s: %w", attachment.Filename, err)
+		}
+		if _, err := w.Write(attachment.Data); err != nil {
+			return false, fmt.Errorf("failed to zip %s: %w", attachment.Filename, err)
+		}
+		original += len(attachment.Data)
+	}
+	if err := archive.Close(); err != nil {
+		return false, fmt.Errorf("failed to zip attachments: %w", err)
+	}
+	if original == 0 || buf.Len() >= original {
+		return false, nil
+	}
+
+	m.Attachments = append(kept, Attachment{
+		Filename:    zippedAttachmentsName,
+		ContentType: "application/zip",
+		Data:        buf.Bytes(),
+	})
+	return true, nil
+}
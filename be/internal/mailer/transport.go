@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+
+	"gopkg.in/mail.v2"
+)
+
+// Transport delivers a rendered message to its recipients. Transports are
+// built once and shared, so the failover state carries across send jobs.
+type Transport interface {
+	Name() string
+	Send(msg *Message, auth Credentials) error
+}
+
+// Credentials are the sending user's own login, used by the SMTP
+// transport. The HTTP API transports authenticate with their API keys and
+// ignore them.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// SendError is returned by the HTTP API transports when the provider
+// rejects a message.
+type SendError struct {
+	Transport  string
+	StatusCode int
+	Body       string
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d: %s", e.Transport, e.StatusCode, e.Body)
+}
+
+// ErrRawUnsupported is returned by transports that can only send messages
+// built from fields, not already encoded signed or encrypted ones.
+var ErrRawUnsupported = errors.New("transport cannot send signed or encrypted messages")
+
+// PermanentError marks a failure to build a message that would fail the
+// same way on every retry, such as a broken template.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err so that IsPermanent reports true for it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether a send error is a permanent rejection of the
+// message (see IsRejected), a message over the size limit or one that
+// cannot be built, as opposed to a temporary failure worth retrying.
+func IsPermanent(err error) bool {
+	// Sending the same oversized message again will not make it fit
+	var sizeErr *SizeError
+	var permanentErr *PermanentError
+	if errors.As(err, &sizeErr) || errors.As(err, &permanentErr) || errors.Is(err, ErrRawUnsupported) {
+		return true
+	}
+	return IsRejected(err)
+}
+
+// IsRejected reports whether the provider refused the message outright,
+// with an SMTP 5xx reply or an HTTP validation error.
+func IsRejected(err error) bool {
+	// gomail hides the SMTP reply inside SendError without unwrapping it
+	var smtpErr *mail.SendError
+	if errors.As(err, &smtpErr) {
+		err = smtpErr.Cause
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500 && protoErr.Code < 600
+	}
+
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		switch sendErr.StatusCode {
+		case 400, 413, 422:
+			return true
+		}
+	}
+	return false
+}
+
+type SMTPTransport struct {
+	host string
+	port int
+}
+
+func NewSMTPTransport(host string, port int) *SMTPTransport {
+	return &SMTPTransport{host: host, port: port}
+}
+
+func (t *SMTPTransport) Name() string {
+	return "smtp"
+}
+
+func (t *SMTPTransport) Send(msg *Message, auth Credentials) error {
+	dialer := mail.NewDialer(t.host, t.port, auth.Username, auth.Password)
+	if msg.Raw == nil {
+		return dialer.DialAndSend(msg.toGomail())
+	}
+
+	sender, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg.From, msg.To, rawMessage(msg.Raw)); err != nil {
+		sender.Close()
+		return &mail.SendError{Cause: err}
+	}
+	return sender.Close()
+}
+
+// rawMessage lets gomail send an already encoded message.
+type rawMessage []byte
+
+func (r rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(r)
+	return int64(n), err
+}
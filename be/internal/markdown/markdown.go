@@ -0,0 +1,95 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// defaultLayout is used when no base layout is configured. Mail clients
+// ignore most CSS, so the styling stays inline and simple.
+const defaultLayout = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+</head>
+<body style="margin:0;padding:0;background:#f4f4f4;">
+<div style="max-width:640px;margin:0 auto;padding:24px;background:#ffffff;font-family:Arial,Helvetica,sans-serif;font-size:14px;line-height:1.5;color:#222222;">
+{{.Content}}
+</div>
+</body>
+</html>
+`
+
+// LayoutData is what the base layout template is executed with. Content
+// is the rendered Markdown body.
+type LayoutData struct {
+	Subject string
+	Content htmltemplate.HTML
+}
+
+// Renderer turns Markdown bodies into HTML wrapped in the base layout.
+// Raw HTML in the Markdown is dropped and links with unsafe schemes are
+// removed, so the output is safe to send.
+type Renderer struct {
+	layoutPath string
+	markdown   goldmark.Markdown
+
+	once   sync.Once
+	layout *htmltemplate.Template
+}
+
+func NewRenderer(layoutPath string) *Renderer {
+	return &Renderer{
+		layoutPath: layoutPath,
+		markdown:   goldmark.New(goldmark.WithExtensions(extension.GFM)),
+	}
+}
+
+func (r *Renderer) loadLayout() *htmltemplate.Template {
+	r.once.Do(func() {
+		r.layout = htmltemplate.Must(htmltemplate.New("layout").Parse(defaultLayout))
+		if r.layoutPath == "" {
+			return
+		}
+		data, err := os.ReadFile(r.layoutPath)
+		if err != nil {
+			log.Printf("Failed to load mail layout %s, falling back to the default: %v", r.layoutPath, err)
+			return
+		}
+		layout, err := htmltemplate.New("layout").Parse(string(data))
+		if err != nil {
+			log.Printf("Invalid mail layout %s, falling back to the default: %v", r.layoutPath, err)
+			return
+		}
+		r.layout = layout
+	})
+	return r.layout
+}
+
+// Render returns the HTML page and the plain text version of a Markdown
+// body.
+func (r *Renderer) Render(subject, body string) (string, string, error) {
+	var content bytes.Buffer
+	if err := r.markdown.Convert([]byte(body), &content); err != nil {
+		return "", "", fmt.Errorf("failed to render Markdown: %w", err)
+	}
+
+	var page bytes.Buffer
+	err := r.loadLayout().Execute(&page, LayoutData{
+		Subject: subject,
+		Content: htmltemplate.HTML(content.String()),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render mail layout: %w", err)
+	}
+	return page.String(), mailer.HTMLToText(content.String()), nil
+}
@@ -0,0 +1,85 @@
+package markdown
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderIsSafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		notWant string
+	}{
+		{"raw html", "Hi <script>alert(1)</script> <b onclick=\"x()\">there</b>", "<p>Hi", "<script"},
+		{"raw html attribute", "<img src=x onerror=alert(1)>", "", "onerror"},
+		{"javascript link", "[click](javascript:alert(1))", "click</a>", "javascript:"},
+		{"safe link", "[site](https://example.com)", `<a href="https://example.com">site</a>`, ""},
+		{"table", "| a | b |\n|---|---|\n| 1 | 2 |", "<table>", ""},
+	}
+	renderer := NewRenderer("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, err := renderer.Render("Subject", tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(html, tt.want) {
+				t.Errorf("HTML does not contain %q:\n%s", tt.want, html)
+			}
+			if tt.notWant != "" && strings.Contains(html, tt.notWant) {
+				t.Errorf("HTML contains %q:\n%s", tt.notWant, html)
+			}
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	_, text, err := NewRenderer("").Render("Subject", "# Hello\n\nSee **this** [site](https://example.com).")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Hello") || !strings.Contains(text, "this") || strings.Contains(text, "<") {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestRenderLayout(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom.html")
+	if err := os.WriteFile(custom, []byte("<main><h1>{{.Subject}}</h1>{{.Content}}</main>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.html")
+	if err := os.WriteFile(invalid, []byte("<main>{{.Content</main>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"default", "", "<!DOCTYPE html>"},
+		{"custom", custom, "<main><h1>A &amp; B</h1><p>Hi</p>\n</main>"},
+		{"missing file", filepath.Join(dir, "missing.html"), "<!DOCTYPE html>"},
+		{"invalid layout", invalid, "<!DOCTYPE html>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, err := NewRenderer(tt.path).Render("A & B", "Hi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(html, tt.want) {
+				t.Errorf("HTML = %q, want it to contain %q", html, tt.want)
+			}
+			if !strings.Contains(html, "<p>Hi</p>") {
+				t.Errorf("HTML = %q, content missing", html)
+			}
+		})
+	}
+}
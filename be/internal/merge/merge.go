@@ -0,0 +1,190 @@
+package merge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/lambertse/cquan_go_webapp/internal/format"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+// Template is the subject and body of a campaign parsed as Go templates.
+// HTML bodies are parsed with html/template, so that values are escaped
+// for where they appear: a javascript: link in href="{{.Link}}" is
+// replaced and values in style attributes are filtered.
+type Template struct {
+	subject *texttemplate.Template
+	body    executor
+}
+
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+var commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// rawTextPattern matches the elements whose content is not HTML, where
+// "<!--" does not start a comment.
+var rawTextPattern = regexp.MustCompile(`(?is)<(style|script)\b.*?</(style|script)\s*>`)
+
+// Parse parses the subject and body of the email configuration.
+func Parse(config *model.EmailConfig) (*Template, error) {
+	var t Template
+	var err error
+
+	funcs := format.Funcs(config.Location())
+
+	// A missing field is an error rather than "<no value>" in the mail
+	t.subject, err = texttemplate.New("subject").Funcs(funcs).Option("missingkey=error").Parse(config.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+
+	if !config.IsHTML() {
+		t.body, err = texttemplate.New("body").Funcs(funcs).Option("missingkey=error").Parse(config.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template: %w", err)
+		}
+		return &t, nil
+	}
+
+	body, comments := protectComments(config.Body)
+	funcs["htmlComment"] = func(i int) htmltemplate.HTML {
+		return htmltemplate.HTML(comments[i])
+	}
+	tmpl, err := htmltemplate.New("body").Funcs(funcs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	// Escaping happens on the first execution; report an action it cannot
+	// place now rather than for every receiver
+	var escapeErr *htmltemplate.Error
+	if err := tmpl.Execute(io.Discard, map[string]string{}); errors.As(err, &escapeErr) {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	t.body = tmpl
+	return &t, nil
+}
+
+// protectComments replaces the HTML comments of the body, which
+// html/template would drop, with calls to htmlComment printing them as
+// written. Outlook relies on conditional comments such as
+// <!--[if mso]>...<![endif]-->; their content stays part of the template,
+// so its actions are escaped as usual. Comments holding actions of their
+// own and "<!--" inside <style> and <script> are left alone.
+func protectComments(body string) (string, []string) {
+	rawText := rawTextPattern.FindAllStringIndex(body, -1)
+	inRawText := func(pos int) bool {
+		for _, span := range rawText {
+			if pos >= span[0] && pos < span[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var comments []string
+	call := func(text string) string {
+		comments = append(comments, text)
+		return fmt.Sprintf("{{htmlComment %d}}", len(comments)-1)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, span := range commentPattern.FindAllStringIndex(body, -1) {
+		if inRawText(span[0]) {
+			continue
+		}
+		b.WriteString(body[last:span[0]])
+		last = span[1]
+
+		comment := body[span[0]:span[1]]
+		content := comment[len("<!--") : len(comment)-len("-->")]
+		start := strings.Index(content, "]>")
+		end := strings.LastIndex(content, "<![endif]")
+		switch {
+		case strings.HasPrefix(content, "[if") && start != -1 && end > start:
+			// <!--[if mso]>...<![endif]-->
+			b.WriteString(call(comment[:len("<!--")+start+2]))
+			b.WriteString(content[start+2 : end])
+			b.WriteString(call(content[end:] + "-->"))
+		case !strings.Contains(comment, "{{"):
+			b.WriteString(call(comment))
+		default:
+			b.WriteString(comment)
+		}
+	}
+	b.WriteString(body[last:])
+	return b.String(), comments
+}
+
+// Cache keeps the templates parsed for a send job, so that every locale and
+// variant is parsed once however many receivers get it.
+type Cache struct {
+	templates map[string]*Template
+}
+
+func NewCache() *Cache {
+	return &Cache{templates: make(map[string]*Template)}
+}
+
+// Parse returns the parsed template of the configuration, parsing it on
+// first use.
+func (c *Cache) Parse(config *model.EmailConfig) (*Template, error) {
+	key := strings.Join([]string{config.ContentType, config.Timezone, config.Subject, config.Body}, "\x00")
+	if t, ok := c.templates[key]; ok {
+		return t, nil
+	}
+	t, err := Parse(config)
+	if err != nil {
+		return nil, err
+	}
+	c.templates[key] = t
+	return t, nil
+}
+
+// IsTemplate reports whether the subject or body has template actions, in
+// which case every receiver gets a different message.
+func IsTemplate(config *model.EmailConfig) bool {
+	return strings.Contains(config.Subject, "{{") || strings.Contains(config.Body, "{{")
+}
+
+// Execute fills the subject and body with the receiver's data.
+func (t *Template) Execute(receiver *model.Receiver) (string, string, error) {
+	data := Data(receiver)
+
+	var subject bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to fill subject: %w", err)
+	}
+
+	var body bytes.Buffer
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("failed to fill body: %w", err)
+	}
+
+	// Header values must stay on one line
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
+
+// Data returns the values a template can refer to: the receiver's fields,
+// e.g. {{.Name}}, and every spreadsheet column by header. Headers that are
+// not identifiers are reached with index, e.g. {{index . "Due date"}}.
+func Data(receiver *model.Receiver) map[string]string {
+	data := make(map[string]string, len(receiver.Fields)+5)
+	for header, value := range receiver.Fields {
+		data[header] = value
+	}
+	data["ID"] = receiver.ID
+	data["Name"] = receiver.Name
+	data["Owner"] = receiver.Owner
+	data["Email"] = receiver.Email
+	data["TaxID"] = receiver.TaxID
+	return data
+}
@@ -0,0 +1,109 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+func TestExecuteHTML(t *testing.T) {
+	receiver := &model.Receiver{
+		Name: `Tom & "Jerry" <tj>`,
+		Fields: map[string]string{
+			"Due":   "2024-03-05",
+			"Link":  `x" onmouseover="alert(1)`,
+			"URL":   "javascript:alert(1)",
+			"Color": "red;background:url(javascript:alert(1))",
+		},
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"value escaped", "<p>{{.Name}}</p>", "<p>Tom &amp; &#34;Jerry&#34; &lt;tj&gt;</p>"},
+		{"attribute escaped", `<a title="{{.Link}}">x</a>`, `<a title="x&#34; onmouseover=&#34;alert(1)">x</a>`},
+		{"function result", `{{date "dd/mm/yyyy" .Due}}`, "05/03/2024"},
+		{"explicit html", "{{.Name | html}}", "Tom &amp; &#34;Jerry&#34; &lt;tj&gt;"},
+		{
+			"conditional comment",
+			"<!--[if mso]><table><tr><td>{{.Name}}</td></tr></table><![endif]-->",
+			"<!--[if mso]><table><tr><td>Tom &amp; &#34;Jerry&#34; &lt;tj&gt;</td></tr></table><![endif]-->",
+		},
+		{"comment", "<!-- note --><p>Hi</p>", "<!-- note --><p>Hi</p>"},
+		{
+			"downlevel revealed comment",
+			"<!--[if !mso]><!--><p>{{.Due}}</p><!--<![endif]-->",
+			"<!--[if !mso]><!--><p>2024-03-05</p><!--<![endif]-->",
+		},
+		{"comment in style", "<style><!-- p { color: red } --></style>", "<style><!-- p { color: red } --></style>"},
+		{"hostile link", `<a href="{{.URL}}">x</a>`, `<a href="#ZgotmplZ">x</a>`},
+		{"hostile style", `<p style="color: {{.Color}}">x</p>`, `<p style="color: ZgotmplZ">x</p>`},
+		{"link with query", `<a href="https://example.com/?n={{.Name}}">x</a>`, `<a href="https://example.com/?n=Tom%20%26%20%22Jerry%22%20%3ctj%3e">x</a>`},
+		{"if and with", `{{if .Name}}{{with .Due}}{{.}} {{end}}{{.Name}}{{end}}`, "2024-03-05 Tom &amp; &#34;Jerry&#34; &lt;tj&gt;"},
+		{"define", `{{define "x"}}<b>{{.Name}}</b>{{end}}{{template "x" .}}`, "<b>Tom &amp; &#34;Jerry&#34; &lt;tj&gt;</b>"},
+		{"variable", `{{$n := .Name}}{{$n}}`, "Tom &amp; &#34;Jerry&#34; &lt;tj&gt;"},
+	}
+	for _, tt := range tests {
+		config := &model.EmailConfig{Subject: "Hi {{.Name}}", Body: tt.body, ContentType: model.ContentTypeHTML}
+		tmpl, err := Parse(config)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		subject, body, err := tmpl.Execute(receiver)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if body != tt.want {
+			t.Errorf("%s: body = %q, want %q", tt.name, body, tt.want)
+		}
+		// The subject is a header, not HTML
+		if subject != `Hi Tom & "Jerry" <tj>` {
+			t.Errorf("%s: subject = %q", tt.name, subject)
+		}
+	}
+}
+
+func TestParseRejectsAmbiguousContext(t *testing.T) {
+	config := &model.EmailConfig{Subject: "Hi", Body: `{{if .Name}}<a href="{{end}}x">`, ContentType: model.ContentTypeHTML}
+	if _, err := Parse(config); err == nil {
+		t.Error("body ending its branches in different contexts parsed")
+	}
+}
+
+func TestExecuteText(t *testing.T) {
+	config := &model.EmailConfig{Subject: "Hi", Body: "Dear {{.Name}}", ContentType: model.ContentTypeText}
+	tmpl, err := Parse(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := tmpl.Execute(&model.Receiver{Name: "A & B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "Dear A & B" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache()
+	config := &model.EmailConfig{Subject: "Hi", Body: "<p>{{.Name}}</p>", ContentType: model.ContentTypeHTML}
+	first, err := cache.Parse(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied := *config
+	if again, _ := cache.Parse(&copied); again != first {
+		t.Error("same content parsed twice")
+	}
+	copied.Body = "<p>{{.Email}}</p>"
+	if other, _ := cache.Parse(&copied); other == first {
+		t.Error("different body got the cached template")
+	}
+	if _, err := cache.Parse(&model.EmailConfig{Subject: "{{", Body: ""}); err == nil {
+		t.Error("invalid template parsed")
+	}
+}
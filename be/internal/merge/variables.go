@@ -0,0 +1,211 @@
+package merge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+// Variable is a receiver value used by a template. A variable is required
+// when its value is printed, one that is only tested by if, with or range
+// or that has a default may be empty.
+type Variable struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+}
+
+// builtinFields are always available, whatever columns the sheet has
+var builtinFields = []string{"ID", "Name", "Owner", "Email", "TaxID"}
+
+// IsBuiltin reports whether name is one of the receiver's own fields.
+func IsBuiltin(name string) bool {
+	for _, field := range builtinFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Variables lists the variables used by the subjects, bodies and documents
+// of the email configuration, sorted by name.
+func Variables(config *model.EmailConfig) ([]Variable, error) {
+	sources := map[string]string{
+		"subject": config.Subject,
+		"body":    config.Body,
+	}
+	for locale, content := range config.Locales {
+		sources["subject "+locale] = content.Subject
+		sources["body "+locale] = content.Body
+	}
+	if config.ABTest != nil {
+		for _, variant := range config.ABTest.Variants {
+			sources["subject variant "+variant.Name] = variant.Subject
+			sources["body variant "+variant.Name] = variant.Body
+		}
+	}
+	for _, doc := range config.Documents {
+		sources["document "+doc.FileName] = doc.Body
+	}
+
+	required := make(map[string]bool)
+	for name, source := range sources {
+		// Functions are checked when the template is parsed for sending
+		tree := parse.New(name)
+		tree.Mode = parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		if _, err := tree.Parse(source, "", "", trees); err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		for _, tree := range trees {
+			collect(tree.Root, required, true, true)
+		}
+	}
+
+	variables := make([]Variable, 0, len(required))
+	for name, isRequired := range required {
+		variables = append(variables, Variable{Name: name, Required: isRequired})
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Name < variables[j].Name
+	})
+	return variables, nil
+}
+
+// collect records the variables of a node. dot tells whether "." still is
+// the receiver, which is not the case inside with and range.
+func collect(node parse.Node, vars map[string]bool, dot, required bool) {
+	add := func(name string, required bool) {
+		if name != "" {
+			vars[name] = vars[name] || required
+		}
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collect(child, vars, dot, required)
+		}
+	case *parse.ActionNode:
+		collect(n.Pipe, vars, dot, required)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		// {{.Note | default "none"}} may be empty
+		for _, cmd := range n.Cmds {
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "default" {
+				required = false
+			}
+		}
+		for _, cmd := range n.Cmds {
+			collect(cmd, vars, dot, required)
+		}
+	case *parse.CommandNode:
+		// index . "Column name"
+		if len(n.Args) >= 3 {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "index" {
+				if isRoot(n.Args[1], dot) {
+					if s, ok := n.Args[2].(*parse.StringNode); ok {
+						add(s.Text, required)
+					}
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			collect(arg, vars, dot, required)
+		}
+	case *parse.FieldNode:
+		if dot {
+			add(n.Ident[0], required)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			add(n.Ident[1], required)
+		}
+	case *parse.ChainNode:
+		collect(n.Node, vars, dot, required)
+	case *parse.IfNode:
+		collectGuarded(n.Pipe, n.List, vars, dot, dot, required)
+		collect(n.ElseList, vars, dot, required)
+	case *parse.WithNode:
+		collectGuarded(n.Pipe, n.List, vars, dot, false, required)
+		collect(n.ElseList, vars, dot, required)
+	case *parse.RangeNode:
+		collect(n.Pipe, vars, dot, false)
+		collect(n.List, vars, false, required)
+		collect(n.ElseList, vars, dot, required)
+	case *parse.TemplateNode:
+		collect(n.Pipe, vars, dot, required)
+	}
+}
+
+// collectGuarded records the variables of an if or with block. Variables
+// tested by the condition may be empty inside the block, as in
+// {{if .Note}}Note: {{.Note}}{{end}}.
+func collectGuarded(cond *parse.PipeNode, list *parse.ListNode, vars map[string]bool, dot, listDot, required bool) {
+	tested := make(map[string]bool)
+	collect(cond, tested, dot, false)
+	for name := range tested {
+		if _, ok := vars[name]; !ok {
+			vars[name] = false
+		}
+	}
+
+	inner := make(map[string]bool)
+	collect(list, inner, listDot, required)
+	for name, isRequired := range inner {
+		_, guarded := tested[name]
+		vars[name] = vars[name] || (isRequired && !guarded)
+	}
+}
+
+func isRoot(node parse.Node, dot bool) bool {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.VariableNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "$"
+	}
+	return false
+}
+
+// Check reports the variables that are neither receiver fields nor columns
+// of the sheet, and the receivers with an empty required variable.
+func Check(variables []Variable, receivers []model.Receiver) ([]string, []model.ReceiverError) {
+	columns := make(map[string]bool)
+	for _, receiver := range receivers {
+		for header := range receiver.Fields {
+			columns[header] = true
+		}
+	}
+
+	var missing []string
+	for _, variable := range variables {
+		if !IsBuiltin(variable.Name) && !columns[variable.Name] {
+			missing = append(missing, variable.Name)
+		}
+	}
+
+	var errors []model.ReceiverError
+	for i := range receivers {
+		receiver := &receivers[i]
+		data := Data(receiver)
+		var empty []string
+		for _, variable := range variables {
+			if value, ok := data[variable.Name]; variable.Required && ok && strings.TrimSpace(value) == "" {
+				empty = append(empty, variable.Name)
+			}
+		}
+		if len(empty) > 0 {
+			errors = append(errors, model.NewReceiverError(receiver, "empty value for "+strings.Join(empty, ", ")))
+		}
+	}
+	return missing, errors
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// ABTest splits the receivers of a campaign between subject and body
+// variants. Assignment depends only on the template and the receiver's
+// address, so sending again puts everyone in the same variant.
+//
+// With a TestPercent between 1 and 99 only that share of the list takes
+// part in the test; the others are held back until the winner is sent to
+// them.
+type ABTest struct {
+	Variants    []ABVariant `json:"variants"`
+	TestPercent int         `json:"test_percent,omitempty"`
+}
+
+// ABVariant replaces the subject and body of the template. Empty fields
+// keep the template's own.
+type ABVariant struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+func (t *ABTest) Validate() error {
+	if len(t.Variants) < 2 {
+		return fmt.Errorf("an A/B test needs at least two variants")
+	}
+	names := make(map[string]bool)
+	total := 0
+	for _, variant := range t.Variants {
+		name := strings.TrimSpace(variant.Name)
+		if name == "" {
+			return fmt.Errorf("every A/B variant needs a name")
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate A/B variant %q", name)
+		}
+		names[name] = true
+		if variant.Percent <= 0 {
+			return fmt.Errorf("A/B variant %q needs a positive percentage", name)
+		}
+		total += variant.Percent
+	}
+	if total != 100 {
+		return fmt.Errorf("A/B variant percentages add up to %d instead of 100", total)
+	}
+	if t.TestPercent < 0 || t.TestPercent > 100 {
+		return fmt.Errorf("test percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+func (t *ABTest) Variant(name string) *ABVariant {
+	for i := range t.Variants {
+		if t.Variants[i].Name == name {
+			return &t.Variants[i]
+		}
+	}
+	return nil
+}
+
+// bucket maps a receiver to a number from 0 to 9999.
+func bucket(seed, email string) int {
+	sum := sha256.Sum256([]byte(seed + "\x00" + strings.ToLower(strings.TrimSpace(email))))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 10000)
+}
+
+// InTestSlice reports whether the receiver takes part in the test or is
+// held back for the winner.
+func (t *ABTest) InTestSlice(seed, email string) bool {
+	if t.TestPercent == 0 || t.TestPercent == 100 {
+		return true
+	}
+	return bucket(seed+"\x00test", email) < t.TestPercent*100
+}
+
+// Assign picks the receiver's variant by the variant percentages.
+func (t *ABTest) Assign(seed, email string) *ABVariant {
+	b := bucket(seed, email)
+	limit := 0
+	for i := range t.Variants {
+		limit += t.Variants[i].Percent * 100
+		if b < limit {
+			return &t.Variants[i]
+		}
+	}
+	return &t.Variants[len(t.Variants)-1]
+}
+
+// Split separates the receivers taking part in the test from those held
+// back.
+func (t *ABTest) Split(seed string, receivers []Receiver) ([]Receiver, []Receiver) {
+	var test, held []Receiver
+	for _, receiver := range receivers {
+		if t.InTestSlice(seed, receiver.Email) {
+			test = append(test, receiver)
+		} else {
+			held = append(held, receiver)
+		}
+	}
+	return test, held
+}
+
+// ForVariant returns the config with the subject and body of the variant
+// and without the A/B test.
+func (e *EmailConfig) ForVariant(variant *ABVariant) *EmailConfig {
+	config := *e
+	config.ABTest = nil
+	if variant.Subject != "" {
+		config.Subject = variant.Subject
+	}
+	if variant.Body != "" {
+		config.Body = variant.Body
+	}
+	return &config
+}
+
+// ForWinner returns the config as sent to the receivers held back for the
+// winner: every receiver gets the named variant and is counted under it. It
+// returns nil when there is no such variant.
+func (e *EmailConfig) ForWinner(name string) *EmailConfig {
+	if e.ABTest == nil {
+		return nil
+	}
+	variant := e.ABTest.Variant(name)
+	if variant == nil {
+		return nil
+	}
+	winner := *variant
+	winner.Percent = 100
+	config := *e
+	config.ABTest = &ABTest{Variants: []ABVariant{winner}}
+	return &config
+}
+
+// ForABTest returns the config as sent to the receiver and the name of its
+// variant, or the config itself when there is no A/B test.
+func (e *EmailConfig) ForABTest(receiver *Receiver) (*EmailConfig, string) {
+	if e.ABTest == nil {
+		return e, ""
+	}
+	variant := e.ABTest.Assign(e.ID, receiver.Email)
+	return e.ForVariant(variant), variant.Name
+}
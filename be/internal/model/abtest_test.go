@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testReceivers(n int) []Receiver {
+	receivers := make([]Receiver, n)
+	for i := range receivers {
+		receivers[i] = Receiver{Email: fmt.Sprintf("user%d@example.com", i)}
+	}
+	return receivers
+}
+
+func TestABTestAssign(t *testing.T) {
+	tests := []struct {
+		name     string
+		percents []int
+	}{
+		{"even", []int{50, 50}},
+		{"uneven", []int{80, 20}},
+		{"three", []int{20, 30, 50}},
+	}
+	receivers := testReceivers(10000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := &ABTest{}
+			for i, percent := range tt.percents {
+				test.Variants = append(test.Variants, ABVariant{Name: fmt.Sprintf("v%d", i), Percent: percent})
+			}
+			if err := test.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			counts := make(map[string]int)
+			for _, receiver := range receivers {
+				variant := test.Assign("template", receiver.Email)
+				counts[variant.Name]++
+			}
+			for i, percent := range tt.percents {
+				got := counts[fmt.Sprintf("v%d", i)] * 100 / len(receivers)
+				if got < percent-3 || got > percent+3 {
+					t.Errorf("variant v%d got %d%% of receivers, want about %d%%", i, got, percent)
+				}
+			}
+		})
+	}
+}
+
+func TestABTestAssignIsStable(t *testing.T) {
+	test := &ABTest{Variants: []ABVariant{{Name: "a", Percent: 50}, {Name: "b", Percent: 50}}}
+	for _, receiver := range testReceivers(100) {
+		first := test.Assign("template", receiver.Email)
+		if again := test.Assign("template", receiver.Email); again.Name != first.Name {
+			t.Fatalf("%s assigned %s then %s", receiver.Email, first.Name, again.Name)
+		}
+		// Case and surrounding spaces of the address do not matter
+		if other := test.Assign("template", " USER"+receiver.Email[4:]+" "); other.Name != first.Name {
+			t.Fatalf("%s assigned %s, differently written %s", receiver.Email, first.Name, other.Name)
+		}
+	}
+}
+
+func TestABTestSplit(t *testing.T) {
+	tests := []struct {
+		name        string
+		testPercent int
+		wantHeld    bool
+	}{
+		{"whole list", 0, false},
+		{"all in test", 100, false},
+		{"slice", 20, true},
+	}
+	receivers := testReceivers(2000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := &ABTest{
+				Variants:    []ABVariant{{Name: "a", Percent: 50}, {Name: "b", Percent: 50}},
+				TestPercent: tt.testPercent,
+			}
+			inTest, held := test.Split("template", receivers)
+			if len(inTest)+len(held) != len(receivers) {
+				t.Fatalf("split %d receivers into %d and %d", len(receivers), len(inTest), len(held))
+			}
+			if !tt.wantHeld {
+				if len(held) != 0 {
+					t.Fatalf("held %d receivers", len(held))
+				}
+				return
+			}
+			got := len(inTest) * 100 / len(receivers)
+			if got < tt.testPercent-3 || got > tt.testPercent+3 {
+				t.Errorf("test slice has %d%% of receivers, want about %d%%", got, tt.testPercent)
+			}
+			for _, receiver := range inTest {
+				if !test.InTestSlice("template", receiver.Email) {
+					t.Fatalf("%s split into the test but not in the test slice", receiver.Email)
+				}
+			}
+			for _, receiver := range held {
+				if test.InTestSlice("template", receiver.Email) {
+					t.Fatalf("%s held but in the test slice", receiver.Email)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Campaign records a send job and the exact template version it used.
+type Campaign struct {
+	ID              string    `json:"id"`
+	TemplateID      string    `json:"template_id"`
+	TemplateVersion int       `json:"template_version"`
+	Sender          string    `json:"sender"`
+	Total           int       `json:"total"`
+	Succeeded       int       `json:"succeeded"`
+	Failed          int       `json:"failed"`
+	Error           string    `json:"error,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	CompletedAt     time.Time `json:"completed_at,omitempty"`
+	// Variants holds the results of an A/B test
+	Variants []VariantStats `json:"variants,omitempty"`
+	// Held counts the receivers kept back for the winner of the test
+	Held   int    `json:"held,omitempty"`
+	Winner string `json:"winner,omitempty"`
+}
+
+// VariantStats counts the receivers of one A/B variant. Opened and Clicked
+// count receivers rather than events; a click also counts as an open.
+// Bounced counts the messages the provider refused outright while sending,
+// such as with an SMTP 5xx reply. Bounce messages returned later by the
+// receiving server are not seen.
+type VariantStats struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+	Sent    int    `json:"sent"`
+	Failed  int    `json:"failed"`
+	Bounced int    `json:"bounced"`
+	Opened  int    `json:"opened"`
+	Clicked int    `json:"clicked"`
+}
+
+// TrackingEvent records the first open and click of a receiver.
+type TrackingEvent struct {
+	Variant   string     `json:"variant,omitempty"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	ClickedAt *time.Time `json:"clicked_at,omitempty"`
+}
+
+var campaignDir = filepath.Join(os.TempDir(), "campaigns")
+var campaignFileName = "campaigns.json"
+var heldReceiverFileName = "held.json"
+var trackingFileName = "tracking.json"
+
+// Only the most recent campaigns are kept
+const maxCampaigns = 1000
+
+var campaignMu sync.Mutex
+
+// ErrWinnerSent is returned when the winner of an A/B test has already
+// been claimed.
+var ErrWinnerSent = errors.New("the winner has already been sent")
+
+// SaveCampaign adds the campaign or replaces the one with the same ID.
+func SaveCampaign(campaign *Campaign) error {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+	return saveCampaign(campaign)
+}
+
+func saveCampaign(campaign *Campaign) error {
+	path := filepath.Join(campaignDir, campaignFileName)
+	var campaigns []Campaign
+	if err := readJSONFile(path, &campaigns); err != nil {
+		return err
+	}
+
+	found := false
+	for i := range campaigns {
+		if campaigns[i].ID == campaign.ID {
+			campaigns[i] = *campaign
+			found = true
+			break
+		}
+	}
+	if !found {
+		campaigns = append(campaigns, *campaign)
+	}
+	if len(campaigns) > maxCampaigns {
+		campaigns = campaigns[len(campaigns)-maxCampaigns:]
+	}
+
+	return writeJSONFile(path, campaigns)
+}
+
+// ClaimWinner records the winner of the campaign's A/B test and adds the
+// held receivers to its total. Checking and setting the winner under one
+// lock lets only one request send it; the others get ErrWinnerSent.
+func ClaimWinner(id, winner string, receivers int) (*Campaign, error) {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+
+	var campaigns []Campaign
+	if err := readJSONFile(filepath.Join(campaignDir, campaignFileName), &campaigns); err != nil {
+		return nil, err
+	}
+	for i := range campaigns {
+		if campaigns[i].ID != id {
+			continue
+		}
+		campaign := campaigns[i]
+		if campaign.Winner != "" {
+			return nil, ErrWinnerSent
+		}
+		campaign.Winner = winner
+		campaign.Held = 0
+		campaign.Total += receivers
+		campaign.CompletedAt = time.Time{}
+		if err := saveCampaign(&campaign); err != nil {
+			return nil, err
+		}
+		return &campaign, nil
+	}
+	return nil, fmt.Errorf("campaign %s not found", id)
+}
+
+// ListCampaigns returns the campaigns, newest first.
+func ListCampaigns() ([]Campaign, error) {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+
+	var campaigns []Campaign
+	if err := readJSONFile(filepath.Join(campaignDir, campaignFileName), &campaigns); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(campaigns)-1; i < j; i, j = i+1, j-1 {
+		campaigns[i], campaigns[j] = campaigns[j], campaigns[i]
+	}
+	for i := range campaigns {
+		if err := campaigns[i].addTracking(); err != nil {
+			return nil, err
+		}
+	}
+	return campaigns, nil
+}
+
+// NewCampaignStats starts the results of every variant of the test.
+func NewCampaignStats(test *ABTest) []VariantStats {
+	var stats []VariantStats
+	for _, variant := range test.Variants {
+		stats = append(stats, VariantStats{Name: variant.Name, Percent: variant.Percent})
+	}
+	return stats
+}
+
+// Stats returns the results of the named variant.
+func (c *Campaign) Stats(variant string) *VariantStats {
+	for i := range c.Variants {
+		if c.Variants[i].Name == variant {
+			return &c.Variants[i]
+		}
+	}
+	return nil
+}
+
+// BestVariant returns the variant with the highest click rate, the open
+// rate breaking ties. It returns "" when the results pick no variant: no
+// opens or clicks were recorded, e.g. with tracking disabled, or the best
+// variants are tied.
+func (c *Campaign) BestVariant() string {
+	best := ""
+	tied := false
+	var bestClicks, bestOpens float64
+	for _, stats := range c.Variants {
+		if stats.Sent == 0 || stats.Opened == 0 {
+			continue
+		}
+		clicks := float64(stats.Clicked) / float64(stats.Sent)
+		opens := float64(stats.Opened) / float64(stats.Sent)
+		switch {
+		case best == "" || clicks > bestClicks || (clicks == bestClicks && opens > bestOpens):
+			best, bestClicks, bestOpens, tied = stats.Name, clicks, opens, false
+		case clicks == bestClicks && opens == bestOpens:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+func campaignPath(id, name string) string {
+	return filepath.Join(campaignDir, safeFileName(id), name)
+}
+
+// addTracking fills in the opens and clicks of the variants.
+func (c *Campaign) addTracking() error {
+	if len(c.Variants) == 0 {
+		return nil
+	}
+	var events map[string]TrackingEvent
+	if err := readJSONFile(campaignPath(c.ID, trackingFileName), &events); err != nil {
+		return err
+	}
+	for i := range c.Variants {
+		c.Variants[i].Opened = 0
+		c.Variants[i].Clicked = 0
+	}
+	for _, event := range events {
+		stats := c.Stats(event.Variant)
+		if stats == nil {
+			continue
+		}
+		if event.OpenedAt != nil || event.ClickedAt != nil {
+			stats.Opened++
+		}
+		if event.ClickedAt != nil {
+			stats.Clicked++
+		}
+	}
+	return nil
+}
+
+// RecordOpen notes that the receiver opened the campaign's message.
+func RecordOpen(campaignID, variant, email string) error {
+	return recordTracking(campaignID, variant, email, false)
+}
+
+// RecordClick notes that the receiver followed a link of the message.
+func RecordClick(campaignID, variant, email string) error {
+	return recordTracking(campaignID, variant, email, true)
+}
+
+func recordTracking(campaignID, variant, email string, click bool) error {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+
+	path := campaignPath(campaignID, trackingFileName)
+	events := make(map[string]TrackingEvent)
+	if err := readJSONFile(path, &events); err != nil {
+		return err
+	}
+
+	key := strings.ToLower(email)
+	event := events[key]
+	event.Variant = variant
+	now := time.Now()
+	if event.OpenedAt == nil {
+		event.OpenedAt = &now
+	}
+	if click && event.ClickedAt == nil {
+		event.ClickedAt = &now
+	}
+	events[key] = event
+	return writeJSONFile(path, events)
+}
+
+// SaveHeldReceivers keeps the receivers left out of the test slice until
+// the winner is sent to them.
+func SaveHeldReceivers(campaignID string, receivers []Receiver) error {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+	return writeJSONFile(campaignPath(campaignID, heldReceiverFileName), receivers)
+}
+
+func GetHeldReceivers(campaignID string) ([]Receiver, error) {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+
+	var receivers []Receiver
+	if err := readJSONFile(campaignPath(campaignID, heldReceiverFileName), &receivers); err != nil {
+		return nil, err
+	}
+	return receivers, nil
+}
+
+func DeleteHeldReceivers(campaignID string) error {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+
+	if err := os.Remove(campaignPath(campaignID, heldReceiverFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete held receivers: %w", err)
+	}
+	return nil
+}
+
+func GetCampaign(id string) (*Campaign, error) {
+	campaigns, err := ListCampaigns()
+	if err != nil {
+		return nil, err
+	}
+	for i := range campaigns {
+		if campaigns[i].ID == id {
+			return &campaigns[i], nil
+		}
+	}
+	return nil, fmt.Errorf("campaign %s not found", id)
+}
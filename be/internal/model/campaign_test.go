@@ -0,0 +1,98 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func useTempCampaignStore(t *testing.T) {
+	t.Helper()
+	dir := campaignDir
+	campaignDir = t.TempDir()
+	t.Cleanup(func() { campaignDir = dir })
+}
+
+func TestBestVariant(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []VariantStats
+		want     string
+	}{
+		{
+			name: "clicks",
+			variants: []VariantStats{
+				{Name: "a", Sent: 100, Opened: 50, Clicked: 5},
+				{Name: "b", Sent: 100, Opened: 30, Clicked: 10},
+			},
+			want: "b",
+		},
+		{
+			name: "opens break a tie",
+			variants: []VariantStats{
+				{Name: "a", Sent: 100, Opened: 50},
+				{Name: "b", Sent: 50, Opened: 30},
+			},
+			want: "b",
+		},
+		{
+			name: "no tracking",
+			variants: []VariantStats{
+				{Name: "a", Sent: 100},
+				{Name: "b", Sent: 100},
+			},
+			want: "",
+		},
+		{
+			name: "tie",
+			variants: []VariantStats{
+				{Name: "a", Sent: 100, Opened: 20, Clicked: 5},
+				{Name: "b", Sent: 100, Opened: 20, Clicked: 5},
+			},
+			want: "",
+		},
+		{
+			name: "unsent",
+			variants: []VariantStats{
+				{Name: "a", Sent: 100, Opened: 1},
+				{Name: "b"},
+			},
+			want: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			campaign := &Campaign{Variants: tt.variants}
+			if got := campaign.BestVariant(); got != tt.want {
+				t.Errorf("BestVariant() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimWinnerOnce(t *testing.T) {
+	useTempCampaignStore(t)
+
+	campaign := &Campaign{ID: NewID(), Total: 20, Held: 80, Variants: []VariantStats{{Name: "a"}, {Name: "b"}}}
+	if err := SaveCampaign(campaign); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := ClaimWinner(campaign.ID, "b", 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed.Winner != "b" || claimed.Held != 0 || claimed.Total != 100 {
+		t.Fatalf("claimed = %+v", claimed)
+	}
+	if _, err := ClaimWinner(campaign.ID, "a", 80); !errors.Is(err, ErrWinnerSent) {
+		t.Fatalf("second claim error = %v, want ErrWinnerSent", err)
+	}
+
+	saved, err := GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Winner != "b" || saved.Total != 100 {
+		t.Fatalf("saved = %+v", saved)
+	}
+}
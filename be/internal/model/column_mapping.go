@@ -0,0 +1,284 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Receiver fields a spreadsheet column can be mapped to
+const (
+	FieldName  = "name"
+	FieldOwner = "owner"
+	FieldEmail = "email"
+	FieldTaxID = "tax_id"
+)
+
+var ReceiverFields = []string{FieldName, FieldOwner, FieldEmail, FieldTaxID}
+
+// columnSynonyms are the normalized headers recognised for each field:
+// lower case, without accents, spaces or punctuation.
+var columnSynonyms = map[string][]string{
+	FieldName: {
+		"name", "company", "companyname", "customer", "customername", "fullname", "organization",
+		"ten", "tencongty", "congty", "tendoanhnghiep", "doanhnghiep", "tenkhachhang", "khachhang", "hoten",
+	},
+	FieldOwner: {
+		"owner", "representative", "contact", "contactname", "director",
+		"chusohuu", "chudoanhnghiep", "nguoidaidien", "daidien", "giamdoc", "nguoilienhe",
+	},
+	FieldEmail: {
+		"email", "mail", "emailaddress", "emailaddr",
+		"diachiemail", "thudientu", "diachithudientu", "hopthu",
+	},
+	FieldTaxID: {
+		"taxid", "taxcode", "taxnumber", "tax", "vat", "vatnumber", "vatid",
+		"mst", "masothue", "masodoanhnghiep", "msdn",
+	},
+}
+
+// ColumnMapping assigns the receiver fields to the headers of one
+// spreadsheet layout. It is applied to later uploads with the same headers.
+type ColumnMapping struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Layout identifies the headers, see LayoutSignature
+	Layout  string   `json:"layout"`
+	Headers []string `json:"headers"`
+	// Columns maps a receiver field, e.g. "email", to its header
+	Columns   map[string]string `json:"columns"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// SheetLayout describes how the columns of an uploaded sheet were read.
+type SheetLayout struct {
+	Sheet   string            `json:"sheet"`
+	Layout  string            `json:"layout"`
+	Headers []string          `json:"headers"`
+	Columns map[string]string `json:"columns"`
+	// MappingID is the saved mapping applied, empty when detected
+	MappingID string `json:"mapping_id,omitempty"`
+	// HasHeader is false when the first row already holds a receiver
+	HasHeader bool `json:"has_header"`
+}
+
+var columnMappingDir = filepath.Join(os.TempDir(), "column_mappings")
+var columnMappingFileName = "mappings.json"
+
+var columnMappingMu sync.Mutex
+
+var accentRemover = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// normalizeHeader drops case, accents and everything but letters and
+// digits, so "E-mail" and "Mã số thuế" become "email" and "masothue".
+func normalizeHeader(header string) string {
+	folded, _, err := transform.String(accentRemover, strings.ToLower(header))
+	if err != nil {
+		folded = strings.ToLower(header)
+	}
+	var b strings.Builder
+	for _, r := range folded {
+		switch {
+		case r == 'đ':
+			b.WriteRune('d')
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// LayoutSignature identifies a layout by its normalized headers, so
+// changes in case, accents or spacing do not matter.
+func LayoutSignature(headers []string) string {
+	normalized := make([]string, 0, len(headers))
+	for _, header := range headers {
+		normalized = append(normalized, normalizeHeader(header))
+	}
+	// Trailing empty columns are not part of the layout
+	for len(normalized) > 0 && normalized[len(normalized)-1] == "" {
+		normalized = normalized[:len(normalized)-1]
+	}
+	sum := sha256.Sum256([]byte(strings.Join(normalized, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// DetectColumns maps the receiver fields to the headers matching their
+// synonyms. The first matching column wins.
+func DetectColumns(headers []string) map[string]string {
+	columns := make(map[string]string)
+	for _, header := range headers {
+		normalized := normalizeHeader(header)
+		if normalized == "" {
+			continue
+		}
+		for field, synonyms := range columnSynonyms {
+			if _, ok := columns[field]; ok {
+				continue
+			}
+			for _, synonym := range synonyms {
+				if normalized == synonym {
+					columns[field] = header
+					break
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// Validate checks that the mapping has an email column and only names
+// known fields and headers.
+func (m *ColumnMapping) Validate() error {
+	if len(m.Headers) == 0 {
+		return fmt.Errorf("headers are required")
+	}
+	for field, header := range m.Columns {
+		known := false
+		for _, f := range ReceiverFields {
+			if f == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(ReceiverFields, ", "))
+		}
+		if headerIndex(m.Headers, header) == -1 {
+			return fmt.Errorf("header %q of field %s is not in the layout", header, field)
+		}
+	}
+	if m.Columns[FieldEmail] == "" {
+		return fmt.Errorf("the email column is required")
+	}
+	return nil
+}
+
+func headerIndex(headers []string, header string) int {
+	for i, h := range headers {
+		if h == header {
+			return i
+		}
+	}
+	for i, h := range headers {
+		if normalizeHeader(h) == normalizeHeader(header) && normalizeHeader(header) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+func ListColumnMappings() ([]ColumnMapping, error) {
+	columnMappingMu.Lock()
+	defer columnMappingMu.Unlock()
+
+	var mappings []ColumnMapping
+	if err := readJSONFile(filepath.Join(columnMappingDir, columnMappingFileName), &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+func GetColumnMapping(id string) (*ColumnMapping, error) {
+	mappings, err := ListColumnMappings()
+	if err != nil {
+		return nil, err
+	}
+	for i := range mappings {
+		if mappings[i].ID == id {
+			return &mappings[i], nil
+		}
+	}
+	return nil, fmt.Errorf("column mapping %s not found", id)
+}
+
+// FindColumnMapping returns the mapping saved for the layout, or nil.
+func FindColumnMapping(layout string) (*ColumnMapping, error) {
+	mappings, err := ListColumnMappings()
+	if err != nil {
+		return nil, err
+	}
+	for i := range mappings {
+		if mappings[i].Layout == layout {
+			return &mappings[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ErrLayoutMapped is returned when saving a mapping for a layout that
+// already has another one.
+var ErrLayoutMapped = errors.New("the layout already has a column mapping")
+
+// SaveColumnMapping creates the mapping when it has no ID and updates it
+// otherwise. A layout has a single mapping, so saving one for a layout
+// mapped by another fails with ErrLayoutMapped; update or delete that one
+// instead.
+func SaveColumnMapping(mapping *ColumnMapping) error {
+	columnMappingMu.Lock()
+	defer columnMappingMu.Unlock()
+
+	path := filepath.Join(columnMappingDir, columnMappingFileName)
+	var mappings []ColumnMapping
+	if err := readJSONFile(path, &mappings); err != nil {
+		return err
+	}
+
+	layout := LayoutSignature(mapping.Headers)
+	index := -1
+	for i := range mappings {
+		switch {
+		case mapping.ID != "" && mappings[i].ID == mapping.ID:
+			index = i
+		case mappings[i].Layout == layout:
+			return fmt.Errorf("%w, %s", ErrLayoutMapped, mappings[i].ID)
+		}
+	}
+	if mapping.ID != "" && index == -1 {
+		return fmt.Errorf("column mapping %s not found", mapping.ID)
+	}
+
+	now := time.Now()
+	mapping.Layout = layout
+	mapping.UpdatedAt = now
+	if index == -1 {
+		mapping.ID = NewID()
+		mapping.CreatedAt = now
+		mappings = append(mappings, *mapping)
+	} else {
+		mapping.CreatedAt = mappings[index].CreatedAt
+		mappings[index] = *mapping
+	}
+	return writeJSONFile(path, mappings)
+}
+
+func DeleteColumnMapping(id string) error {
+	columnMappingMu.Lock()
+	defer columnMappingMu.Unlock()
+
+	path := filepath.Join(columnMappingDir, columnMappingFileName)
+	var mappings []ColumnMapping
+	if err := readJSONFile(path, &mappings); err != nil {
+		return err
+	}
+
+	for i := range mappings {
+		if mappings[i].ID == id {
+			mappings = append(mappings[:i], mappings[i+1:]...)
+			return writeJSONFile(path, mappings)
+		}
+	}
+	return fmt.Errorf("column mapping %s not found", id)
+}
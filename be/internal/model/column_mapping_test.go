@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDetectColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    map[string]string
+	}{
+		{
+			name:    "english",
+			headers: []string{"Company Name", "Owner", "E-mail", "Tax ID"},
+			want:    map[string]string{FieldName: "Company Name", FieldOwner: "Owner", FieldEmail: "E-mail", FieldTaxID: "Tax ID"},
+		},
+		{
+			name:    "vietnamese with accents",
+			headers: []string{"Tên công ty", "Người đại diện", "Địa chỉ email", "Mã số thuế"},
+			want:    map[string]string{FieldName: "Tên công ty", FieldOwner: "Người đại diện", FieldEmail: "Địa chỉ email", FieldTaxID: "Mã số thuế"},
+		},
+		{
+			name:    "vietnamese without accents and odd spacing",
+			headers: []string{"  TEN  KHACH HANG ", "thu dien tu", "MST"},
+			want:    map[string]string{FieldName: "  TEN  KHACH HANG ", FieldEmail: "thu dien tu", FieldTaxID: "MST"},
+		},
+		{
+			name:    "first matching column wins",
+			headers: []string{"Email", "Mail", "Hộp thư"},
+			want:    map[string]string{FieldEmail: "Email"},
+		},
+		{
+			name:    "unknown and empty headers",
+			headers: []string{"", "Ghi chú", "Amount", "Emails"},
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectColumns(tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectColumns(%q) = %v, want %v", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutSignature(t *testing.T) {
+	base := LayoutSignature([]string{"Tên công ty", "Email"})
+	if got := LayoutSignature([]string{"TEN CONG TY", "E-mail", "", ""}); got != base {
+		t.Errorf("signature changed with case, accents and trailing empty columns")
+	}
+	if got := LayoutSignature([]string{"Email", "Tên công ty"}); got == base {
+		t.Errorf("signature did not change with the column order")
+	}
+}
+
+func TestSaveColumnMappingLayoutConflict(t *testing.T) {
+	useTempColumnMappingStore(t)
+
+	headers := []string{"Tên", "Email"}
+	first := &ColumnMapping{Name: "first", Headers: headers, Columns: map[string]string{FieldEmail: "Email"}}
+	if err := SaveColumnMapping(first); err != nil {
+		t.Fatal(err)
+	}
+	other := &ColumnMapping{Name: "other", Headers: []string{"Email"}, Columns: map[string]string{FieldEmail: "Email"}}
+	if err := SaveColumnMapping(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same layout written differently
+	second := &ColumnMapping{Name: "second", Headers: []string{"TEN", "E-mail"}, Columns: map[string]string{FieldEmail: "E-mail"}}
+	if err := SaveColumnMapping(second); !errors.Is(err, ErrLayoutMapped) {
+		t.Fatalf("creating a second mapping: err = %v, want %v", err, ErrLayoutMapped)
+	}
+	if second.ID != "" {
+		t.Errorf("rejected mapping got ID %q", second.ID)
+	}
+	other.Headers, other.Columns = second.Headers, second.Columns
+	if err := SaveColumnMapping(other); !errors.Is(err, ErrLayoutMapped) {
+		t.Fatalf("moving a mapping to the layout: err = %v, want %v", err, ErrLayoutMapped)
+	}
+
+	// The mapping of the layout itself can be updated
+	first.Name = "renamed"
+	first.Headers = second.Headers
+	first.Columns = second.Columns
+	if err := SaveColumnMapping(first); err != nil {
+		t.Fatal(err)
+	}
+
+	mappings, err := ListColumnMappings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("mappings = %+v", mappings)
+	}
+	found, err := FindColumnMapping(LayoutSignature(headers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.ID != first.ID || found.Name != "renamed" {
+		t.Fatalf("found = %+v", found)
+	}
+}
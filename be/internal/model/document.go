@@ -0,0 +1,73 @@
+package model
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/lambertse/cquan_go_webapp/internal/format"
+)
+
+const (
+	DocumentFormatHTML = "html"
+	DocumentFormatText = "text"
+)
+
+// DocumentTemplate describes a PDF generated for every receiver at send
+// time. Body is a Go template over the receiver's fields. The "html"
+// format supports basic markup (<b>, <i>, <u>, <a>, <br>, <p>, <h1>-<h3>,
+// <center>), the "text" format is a simple layout where lines starting
+// with "# " are headings and "---" draws a rule.
+type DocumentTemplate struct {
+	FileName    string `json:"file_name"`
+	Format      string `json:"format"`
+	Title       string `json:"title,omitempty"`
+	Body        string `json:"body"`
+	PageSize    string `json:"page_size,omitempty"`
+	Orientation string `json:"orientation,omitempty"`
+}
+
+// DocumentPageSizes are the page sizes a document can be printed on
+var DocumentPageSizes = []string{"A1", "A2", "A3", "A4", "A5", "A6", "Letter", "Legal", "Tabloid"}
+
+func (d *DocumentTemplate) Validate() error {
+	if strings.TrimSpace(d.FileName) == "" {
+		return fmt.Errorf("document file name is required")
+	}
+	if d.PageSize != "" && !validPageSize(d.PageSize) {
+		return fmt.Errorf("page size of document %s must be one of %s", d.FileName, strings.Join(DocumentPageSizes, ", "))
+	}
+	switch d.Format {
+	case DocumentFormatHTML:
+		if _, err := htmltemplate.New("document").Funcs(format.Funcs(nil)).Option("missingkey=error").Parse(d.Body); err != nil {
+			return fmt.Errorf("invalid document template %s: %w", d.FileName, err)
+		}
+	case DocumentFormatText:
+		if _, err := texttemplate.New("document").Funcs(format.Funcs(nil)).Option("missingkey=error").Parse(d.Body); err != nil {
+			return fmt.Errorf("invalid document template %s: %w", d.FileName, err)
+		}
+	default:
+		return fmt.Errorf("document format must be %q or %q", DocumentFormatHTML, DocumentFormatText)
+	}
+	return nil
+}
+
+func validPageSize(size string) bool {
+	for _, known := range DocumentPageSizes {
+		if strings.EqualFold(size, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileNameFor fills the {{Field}} placeholders of the file name with the
+// receiver's fields and makes sure it ends in .pdf.
+func (d *DocumentTemplate) FileNameFor(receiver *Receiver) string {
+	name := fillPlaceholders(d.FileName, receiver, safeFileName)
+	if !strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		name += ".pdf"
+	}
+	return name
+}
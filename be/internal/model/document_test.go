@@ -0,0 +1,25 @@
+package model
+
+import "testing"
+
+func TestDocumentTemplateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     DocumentTemplate
+		wantErr bool
+	}{
+		{"valid", DocumentTemplate{FileName: "a.pdf", Format: DocumentFormatText, Body: "{{.Name}}"}, false},
+		{"page size in any case", DocumentTemplate{FileName: "a.pdf", Format: DocumentFormatHTML, Body: "x", PageSize: "letter"}, false},
+		{"unknown page size", DocumentTemplate{FileName: "a.pdf", Format: DocumentFormatText, Body: "x", PageSize: "B99"}, true},
+		{"no file name", DocumentTemplate{Format: DocumentFormatText, Body: "x"}, true},
+		{"unknown format", DocumentTemplate{FileName: "a.pdf", Format: "docx", Body: "x"}, true},
+		{"broken template", DocumentTemplate{FileName: "a.pdf", Format: DocumentFormatHTML, Body: "{{.Name"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.doc.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
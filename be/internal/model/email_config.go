@@ -6,15 +6,58 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	ContentTypeText = "text/plain"
+	ContentTypeHTML = "text/html"
+	// ContentTypeMarkdown bodies are sent as HTML in the base layout
+	ContentTypeMarkdown = "text/markdown"
+)
+
+// EmailConfig is a named email template. The one edited through
+// /email-config is stored as StandardTemplateID.
 type EmailConfig struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
 	Subject     string       `json:"subject"`
 	Body        string       `json:"body"`
+	ContentType string       `json:"content_type"`
 	Attachments []Attachment `json:"attachments"`
-	CreatedAt   time.Time    `json:"created_at"`
+	// ReceiverAttachments adds a file matched per receiver on top of Attachments
+	ReceiverAttachments *ReceiverAttachments `json:"receiver_attachments,omitempty"`
+	// Documents are rendered to a PDF attachment for every receiver
+	Documents []DocumentTemplate `json:"documents,omitempty"`
+	Footer    *Footer            `json:"footer,omitempty"`
+	SMIME     *SMIMEOptions      `json:"smime,omitempty"`
+	// PGPPolicy is "off", "prefer" or "require" encryption for receivers
+	// with a registered PGP key
+	PGPPolicy string `json:"pgp_policy,omitempty"`
+	// ZipOversizedAttachments bundles the attachments into one zip when the
+	// message would otherwise exceed the size limit
+	ZipOversizedAttachments bool `json:"zip_oversized_attachments"`
+	// Locales holds the content for receivers whose LocaleColumn names one
+	// of its keys, e.g. "vi" or "en". Other receivers get the default
+	// content above, reported as DefaultLocale.
+	Locales       map[string]LocaleContent `json:"locales,omitempty"`
+	LocaleColumn  string                   `json:"locale_column,omitempty"`
+	DefaultLocale string                   `json:"default_locale,omitempty"`
+	// Timezone is used by the date helpers of the templates, UTC by default
+	Timezone string  `json:"timezone,omitempty"`
+	ABTest   *ABTest `json:"ab_test,omitempty"`
+	// Version counts the saves of the template, each kept in its history
+	Version   int       `json:"version"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// attachmentDir is set on the variant of a locale with its own
+	// attachments
+	attachmentDir string
 }
 
 type Attachment struct {
@@ -22,19 +65,86 @@ type Attachment struct {
 	Type string `json:"type"`
 	Size int64  `json:"size"`
 	Data string `json:"data"`
+	// Inline attachments are embedded with a Content-ID and referenced from
+	// the HTML body as <img src="name"> or <img src="cid:content_id">
+	Inline    bool   `json:"inline,omitempty"`
+	ContentID string `json:"content_id,omitempty"`
 }
 
+// EmailConfigSummary is a template as listed, without its attachments.
+type EmailConfigSummary struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Subject     string    `json:"subject"`
+	ContentType string    `json:"content_type"`
+	Version     int       `json:"version"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const (
+	StandardTemplateID   = "standard"
+	StandardTemplateName = "Standard email"
+)
+
 var configDir = filepath.Join(os.TempDir(), "email_configs")
-var configFileName = "standard_email.json"
-var attachmentDir = filepath.Join(os.TempDir(), "email_configs", "email_attachments")
+var templateDir = filepath.Join(configDir, "templates")
+var templateFileName = "template.json"
+
+// The single template stored before the template library existed
+var legacyConfigFileName = "standard_email.json"
+var legacyAttachmentDir = filepath.Join(configDir, "email_attachments")
+
+var emailConfigMu sync.Mutex
+
+// validTemplateID reports whether id can name a template: the standard
+// template or an ID made by NewID. Anything else could point outside the
+// template's own directory.
+func validTemplateID(id string) bool {
+	return id == StandardTemplateID || IsID(id)
+}
+
+func templatePath(id string) string {
+	return filepath.Join(templateDir, safeFileName(id), templateFileName)
+}
 
 func (e *EmailConfig) PrintEmailConfig() {
 	fmt.Println("Subject:", e.Subject)
 	fmt.Println("Body:", e.Body)
+	fmt.Println("ContentType:", e.ContentType)
 	fmt.Println("Attachments count:", len(e.Attachments))
 	fmt.Println("CreatedAt:", e.CreatedAt)
 }
 
+// IsHTML reports whether the body is HTML.
+func (e *EmailConfig) IsHTML() bool {
+	return e.ContentType == ContentTypeHTML
+}
+
+// defaultContentType marks configs stored without a content type as plain
+// text, which is how they were sent before the content type was added.
+func (e *EmailConfig) defaultContentType() {
+	if e.ContentType == "" {
+		e.ContentType = ContentTypeText
+	}
+}
+
+func (e *EmailConfig) IsMarkdown() bool {
+	return e.ContentType == ContentTypeMarkdown
+}
+
+// Location returns the timezone of the templates, UTC when unset or
+// unknown.
+func (e *EmailConfig) Location() *time.Location {
+	if e.Timezone != "" {
+		if loc, err := time.LoadLocation(e.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
 func parseDataURL(dataURL string) ([]byte, error) {
 	// Data URL format: data:mime/type;base64,<base64-encoded-data>
 	if !strings.HasPrefix(dataURL, "data:") {
@@ -54,69 +164,212 @@ func parseDataURL(dataURL string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(base64Data)
 }
 
-func SaveEmailConfig(config *EmailConfig) error {
-	// Remove the configDir if it exists to ensure only one config is stored
-	if _, err := os.Stat(configDir); err == nil {
-		if err := os.RemoveAll(configDir); err != nil {
-			return fmt.Errorf("failed to remove existing config directory: %w", err)
-		}
-	}
-
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
+// Decode returns the attachment content carried in its data URL.
+func (a *Attachment) Decode() ([]byte, error) {
+	return parseDataURL(a.Data)
+}
 
-	// Set creation timestamp
-	config.CreatedAt = time.Now()
-	path := filepath.Join(configDir, configFileName)
+// SaveEmailConfig creates the template when it has no ID yet and replaces
+// it otherwise, keeping the saved content as a new version. Other templates
+// are left alone.
+func SaveEmailConfig(config *EmailConfig, author string) error {
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+	return saveEmailConfig(config, author)
+}
 
-	// Save main config file
-	configJSON, err := json.MarshalIndent(config, "", "  ")
+func saveEmailConfig(config *EmailConfig, author string) error {
+	now := time.Now()
+	if config.ID == "" {
+		config.ID = NewID()
+	}
+	if !validTemplateID(config.ID) {
+		return fmt.Errorf("invalid template ID %q", config.ID)
+	}
+	var existing EmailConfig
+	if err := readJSONFile(templatePath(config.ID), &existing); err != nil {
+		return err
+	}
+	if err := ensureFirstVersion(&existing); err != nil {
+		return err
+	}
+	if !existing.CreatedAt.IsZero() {
+		config.CreatedAt = existing.CreatedAt
+	} else if config.CreatedAt.IsZero() {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+	config.UpdatedBy = author
+	// A version written before a failed template write must not be reused
+	latest, err := latestTemplateVersion(config.ID)
 	if err != nil {
-		return fmt.Errorf("failed to serialize config: %w", err)
+		return err
+	}
+	config.Version = max(existing.Version, latest) + 1
+
+	if err := saveTemplateVersion(config); err != nil {
+		return err
+	}
+	if err := writeJSONFile(templatePath(config.ID), config); err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(path, configJSON, 0644); err != nil {
-		return fmt.Errorf("failed to save config file: %w", err)
+	// Save attachments as separate files, dropping those of the previous
+	// version
+	for _, dir := range []string{config.templateAttachmentDir(), config.templateLocaleDir()} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove old attachments: %w", err)
+		}
 	}
+	saveAttachments(config.templateAttachmentDir(), config.Attachments)
+	for locale, content := range config.Locales {
+		saveAttachments(config.LocaleAttachmentDir(locale), content.Attachments)
+	}
+
+	return nil
+}
 
-	// Save attachments as separate files if they exist
-	if len(config.Attachments) > 0 {
-		if err := os.MkdirAll(attachmentDir, 0755); err != nil {
-			fmt.Printf("Warning: Failed to create attachment directory: %v\n", err)
+func saveAttachments(dir string, attachments []Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("Warning: Failed to create attachment directory: %v\n", err)
+		return
+	}
+	for _, attachment := range attachments {
+		attachmentPath := filepath.Join(dir, attachment.Name)
+		// Parse base64 data URL and decode
+		if decoded, err := parseDataURL(attachment.Data); err != nil {
+			fmt.Printf("Warning: Failed to decode attachment %s: %v\n", attachment.Name, err)
 		} else {
-			for _, attachment := range config.Attachments {
-				attachmentPath := filepath.Join(attachmentDir, attachment.Name)
-				// Parse base64 data URL and decode
-				if decoded, err := parseDataURL(attachment.Data); err != nil {
-					fmt.Printf("Warning: Failed to decode attachment %s: %v\n", attachment.Name, err)
-				} else {
-					if err := os.WriteFile(attachmentPath, decoded, 0644); err != nil {
-						fmt.Printf("Warning: Failed to save attachment %s: %v\n", attachment.Name, err)
-					}
-				}
+			if err := os.WriteFile(attachmentPath, decoded, 0644); err != nil {
+				fmt.Printf("Warning: Failed to save attachment %s: %v\n", attachment.Name, err)
 			}
 		}
 	}
+}
 
-	return nil
+// GetEmailConfig returns the template with the given ID.
+func GetEmailConfig(id string) (*EmailConfig, error) {
+	if !validTemplateID(id) {
+		return nil, fmt.Errorf("template %s not found", id)
+	}
+
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+
+	if id == StandardTemplateID {
+		if err := migrateLegacyConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	var config EmailConfig
+	if err := readJSONFile(templatePath(id), &config); err != nil {
+		return nil, err
+	}
+	if config.ID == "" {
+		return nil, fmt.Errorf("template %s not found", id)
+	}
+	if err := ensureFirstVersion(&config); err != nil {
+		return nil, err
+	}
+	config.defaultContentType()
+	return &config, nil
 }
 
+// GetLatestEmailConfig returns the standard template.
 func GetLatestEmailConfig() (*EmailConfig, error) {
-	// Read the latest config file
-	configPath := filepath.Join(configDir, configFileName)
-	configData, err := os.ReadFile(configPath)
+	return GetEmailConfig(StandardTemplateID)
+}
+
+// ListEmailConfigs returns every template, most recently updated first.
+func ListEmailConfigs() ([]EmailConfigSummary, error) {
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+
+	if err := migrateLegacyConfig(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(templateDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	var summaries []EmailConfigSummary
+	for _, entry := range entries {
+		var config EmailConfig
+		if err := readJSONFile(filepath.Join(templateDir, entry.Name(), templateFileName), &config); err != nil || config.ID == "" {
+			continue
+		}
+		if err := ensureFirstVersion(&config); err != nil {
+			return nil, err
+		}
+		config.defaultContentType()
+		summaries = append(summaries, EmailConfigSummary{
+			ID:          config.ID,
+			Name:        config.Name,
+			Subject:     config.Subject,
+			ContentType: config.ContentType,
+			Version:     config.Version,
+			UpdatedBy:   config.UpdatedBy,
+			CreatedAt:   config.CreatedAt,
+			UpdatedAt:   config.UpdatedAt,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+	return summaries, nil
+}
+
+func DeleteEmailConfig(id string) error {
+	if !validTemplateID(id) {
+		return fmt.Errorf("template %s not found", id)
+	}
+
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+
+	dir := filepath.Dir(templatePath(id))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("template %s not found", id)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// migrateLegacyConfig moves the single config saved by earlier versions
+// into the library as the standard template. Its attachments are rewritten
+// from the data URLs kept in the config.
+func migrateLegacyConfig() error {
+	path := filepath.Join(configDir, legacyConfigFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
 	}
 
 	var config EmailConfig
-	if err := json.Unmarshal(configData, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := readJSONFile(path, &config); err != nil {
+		return err
+	}
+	config.ID = StandardTemplateID
+	if config.Name == "" {
+		config.Name = StandardTemplateName
+	}
+	config.defaultContentType()
+	if err := saveEmailConfig(&config, config.UpdatedBy); err != nil {
+		return err
 	}
 
-	return &config, nil
+	os.RemoveAll(legacyAttachmentDir)
+	return os.Remove(path)
 }
 
 func (e *EmailConfig) GetEmailConfigAsJSON() string {
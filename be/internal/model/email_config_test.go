@@ -0,0 +1,91 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func useTempTemplateStore(t *testing.T) {
+	t.Helper()
+	config, templates, attachments := configDir, templateDir, legacyAttachmentDir
+	configDir = t.TempDir()
+	templateDir = filepath.Join(configDir, "templates")
+	legacyAttachmentDir = filepath.Join(configDir, "email_attachments")
+	t.Cleanup(func() {
+		configDir, templateDir, legacyAttachmentDir = config, templates, attachments
+	})
+}
+
+func TestLegacyConfigWithoutContentTypeIsText(t *testing.T) {
+	useTempTemplateStore(t)
+
+	legacy := map[string]string{
+		"subject": "Hello",
+		"body":    "Hello {{.Name}},\n\nSee you soon",
+	}
+	if err := writeJSONFile(filepath.Join(configDir, legacyConfigFileName), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := GetLatestEmailConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ContentType != ContentTypeText {
+		t.Errorf("content type = %q, want %q", config.ContentType, ContentTypeText)
+	}
+
+	summaries, err := ListEmailConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].ContentType != ContentTypeText {
+		t.Errorf("summaries = %+v", summaries)
+	}
+}
+
+func TestTemplateWithoutContentTypeIsText(t *testing.T) {
+	useTempTemplateStore(t)
+
+	// Saved by a library version that left the content type empty
+	stored := map[string]any{"id": "abc", "subject": "Hello", "body": "Hi", "version": 1}
+	if err := writeJSONFile(templatePath("abc"), stored); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := GetEmailConfig("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ContentType != ContentTypeText {
+		t.Errorf("content type = %q, want %q", config.ContentType, ContentTypeText)
+	}
+}
+
+func TestInvalidTemplateIDs(t *testing.T) {
+	useTempTemplateStore(t)
+
+	config := EmailConfig{Name: "Kept", Subject: "Hello", ContentType: ContentTypeText}
+	if err := SaveEmailConfig(&config, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"", ".", "..", "../templates", "ABC", "kept", "0123456789abcdef0"} {
+		if err := DeleteEmailConfig(id); err == nil {
+			t.Errorf("DeleteEmailConfig(%q) succeeded", id)
+		}
+		if _, err := GetEmailConfig(id); err == nil {
+			t.Errorf("GetEmailConfig(%q) succeeded", id)
+		}
+		if _, err := ListTemplateVersions(id); err == nil {
+			t.Errorf("ListTemplateVersions(%q) succeeded", id)
+		}
+	}
+
+	if _, err := GetEmailConfig(config.ID); err != nil {
+		t.Fatalf("template gone after invalid deletes: %v", err)
+	}
+	if err := DeleteEmailConfig(config.ID); err != nil {
+		t.Fatal(err)
+	}
+}
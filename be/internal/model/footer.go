@@ -0,0 +1,136 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/format"
+)
+
+// Footer is a signature appended to every mail. The templates can use
+// {{.SenderName}}, {{.Date}} and {{.Timezone}}.
+type Footer struct {
+	HTML       string `json:"html"`
+	Text       string `json:"text"`
+	SenderName string `json:"sender_name,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+	// DateFormat is a layout such as "dd/mm/yyyy HH:MI" or a Go layout
+	DateFormat string    `json:"date_format,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+type FooterData struct {
+	SenderName string
+	Date       string
+	Timezone   string
+}
+
+const defaultFooterDateFormat = "2006-01-02 15:04"
+
+var footerDir = filepath.Join(os.TempDir(), "footers")
+
+func (f *Footer) IsEmpty() bool {
+	return f == nil || (strings.TrimSpace(f.HTML) == "" && strings.TrimSpace(f.Text) == "")
+}
+
+// Validate checks that the timezone is known and both templates parse.
+func (f *Footer) Validate() error {
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", f.Timezone, err)
+		}
+	}
+	if _, err := htmltemplate.New("footer").Parse(f.HTML); err != nil {
+		return fmt.Errorf("invalid HTML footer: %w", err)
+	}
+	if _, err := texttemplate.New("footer").Parse(f.Text); err != nil {
+		return fmt.Errorf("invalid text footer: %w", err)
+	}
+	return nil
+}
+
+// Data builds the template variables for a footer sent by sender at now.
+func (f *Footer) Data(sender string, now time.Time) FooterData {
+	location := time.UTC
+	if f.Timezone != "" {
+		if loc, err := time.LoadLocation(f.Timezone); err == nil {
+			location = loc
+		}
+	}
+	layout := defaultFooterDateFormat
+	if f.DateFormat != "" {
+		layout = format.GoLayout(f.DateFormat)
+	}
+	senderName := f.SenderName
+	if senderName == "" {
+		senderName = sender
+	}
+	return FooterData{
+		SenderName: senderName,
+		Date:       now.In(location).Format(layout),
+		Timezone:   location.String(),
+	}
+}
+
+// Render executes the HTML and text footer templates. When only the text
+// version is set, the HTML version is derived from it.
+func (f *Footer) Render(data FooterData) (string, string, error) {
+	var text bytes.Buffer
+	if f.Text != "" {
+		tmpl, err := texttemplate.New("footer").Parse(f.Text)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid text footer: %w", err)
+		}
+		if err := tmpl.Execute(&text, data); err != nil {
+			return "", "", fmt.Errorf("failed to render text footer: %w", err)
+		}
+	}
+
+	if f.HTML == "" {
+		escaped := htmltemplate.HTMLEscapeString(text.String())
+		return strings.ReplaceAll(escaped, "\n", "<br>\n"), text.String(), nil
+	}
+
+	var html bytes.Buffer
+	tmpl, err := htmltemplate.New("footer").Parse(f.HTML)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid HTML footer: %w", err)
+	}
+	if err := tmpl.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("failed to render HTML footer: %w", err)
+	}
+	return html.String(), text.String(), nil
+}
+
+func footerPath(username string) string {
+	// Usernames are email addresses; keep them safe to use as file names
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(username)
+	return filepath.Join(footerDir, name+".json")
+}
+
+// GetUserFooter returns the footer of the given user, or nil if none is set.
+func GetUserFooter(username string) (*Footer, error) {
+	var footer *Footer
+	if err := readJSONFile(footerPath(username), &footer); err != nil {
+		return nil, err
+	}
+	return footer, nil
+}
+
+func SaveUserFooter(username string, footer *Footer) error {
+	footer.UpdatedAt = time.Now()
+	return writeJSONFile(footerPath(username), footer)
+}
+
+func DeleteUserFooter(username string) error {
+	if err := os.Remove(footerPath(username)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete footer: %w", err)
+	}
+	return nil
+}
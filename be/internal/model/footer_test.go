@@ -0,0 +1,97 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFooterData(t *testing.T) {
+	now := time.Date(2024, 3, 5, 17, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		footer Footer
+		want   FooterData
+	}{
+		{
+			name:   "defaults",
+			footer: Footer{},
+			want:   FooterData{SenderName: "me@example.com", Date: "2024-03-05 17:30", Timezone: "UTC"},
+		},
+		{
+			name:   "sender name and timezone",
+			footer: Footer{SenderName: "Quân", Timezone: "Asia/Ho_Chi_Minh"},
+			want:   FooterData{SenderName: "Quân", Date: "2024-03-06 00:30", Timezone: "Asia/Ho_Chi_Minh"},
+		},
+		{
+			name:   "day first layout",
+			footer: Footer{DateFormat: "dd/mm/yyyy HH:MI"},
+			want:   FooterData{SenderName: "me@example.com", Date: "05/03/2024 17:30", Timezone: "UTC"},
+		},
+		{
+			name:   "go layout",
+			footer: Footer{DateFormat: "Jan 2, 2006"},
+			want:   FooterData{SenderName: "me@example.com", Date: "Mar 5, 2024", Timezone: "UTC"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.footer.Data("me@example.com", now); got != tt.want {
+				t.Errorf("Data() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFooterRender(t *testing.T) {
+	data := FooterData{SenderName: "A & B", Date: "05/03/2024", Timezone: "UTC"}
+	tests := []struct {
+		name     string
+		footer   Footer
+		wantHTML string
+		wantText string
+	}{
+		{
+			name:     "html derived from text",
+			footer:   Footer{Text: "{{.SenderName}}\n{{.Date}}"},
+			wantHTML: "A &amp; B<br>\n05/03/2024",
+			wantText: "A & B\n05/03/2024",
+		},
+		{
+			name:     "both versions",
+			footer:   Footer{HTML: "<b>{{.SenderName}}</b>", Text: "{{.SenderName}}"},
+			wantHTML: "<b>A &amp; B</b>",
+			wantText: "A & B",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, text, err := tt.footer.Render(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != tt.wantHTML || text != tt.wantText {
+				t.Errorf("Render() = %q, %q, want %q, %q", html, text, tt.wantHTML, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestFooterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		footer  Footer
+		wantErr bool
+	}{
+		{"valid", Footer{HTML: "<p>{{.SenderName}}</p>", Text: "{{.SenderName}}", Timezone: "Asia/Ho_Chi_Minh"}, false},
+		{"unknown timezone", Footer{Text: "x", Timezone: "Mars/Base"}, true},
+		{"broken html template", Footer{HTML: "{{.SenderName"}, true},
+		{"broken text template", Footer{Text: "{{if}}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.footer.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
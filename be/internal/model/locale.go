@@ -0,0 +1,132 @@
+package model
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultLocaleColumn is the sheet column read when LocaleColumn is empty
+const DefaultLocaleColumn = "Language"
+
+// LocaleContent is the subject, body and attachments sent to receivers of
+// one locale. Empty fields fall back to the default content of the config.
+type LocaleContent struct {
+	Subject     string       `json:"subject,omitempty"`
+	Body        string       `json:"body,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+func (e *EmailConfig) templateAttachmentDir() string {
+	return filepath.Join(filepath.Dir(templatePath(e.ID)), "attachments")
+}
+
+// LocaleAttachmentDir is where the attachments of a locale are stored, apart
+// from the default ones so that files of the same name do not clash.
+func (e *EmailConfig) LocaleAttachmentDir(locale string) string {
+	return filepath.Join(e.templateLocaleDir(), safeFileName(strings.ToLower(locale)))
+}
+
+func (e *EmailConfig) templateLocaleDir() string {
+	return filepath.Join(filepath.Dir(templatePath(e.ID)), "locales")
+}
+
+// AttachmentDir is the folder holding the stored attachments of the config.
+func (e *EmailConfig) AttachmentDir() string {
+	if e.attachmentDir != "" {
+		return e.attachmentDir
+	}
+	return e.templateAttachmentDir()
+}
+
+// DefaultLocaleName is the locale reported for receivers that get the
+// default content.
+func (e *EmailConfig) DefaultLocaleName() string {
+	if e.DefaultLocale != "" {
+		return e.DefaultLocale
+	}
+	return "default"
+}
+
+// LocaleNames returns the configured locales in order.
+func (e *EmailConfig) LocaleNames() []string {
+	names := make([]string, 0, len(e.Locales))
+	for name := range e.Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConfigVariant is one of the ways a template can be sent.
+type ConfigVariant struct {
+	// Label is empty for the default content, e.g. "locale vi" otherwise
+	Label  string
+	Config *EmailConfig
+}
+
+// Variants returns the default config followed by the config of every
+// locale and A/B variant.
+func (e *EmailConfig) Variants() []ConfigVariant {
+	variants := []ConfigVariant{{Config: e}}
+	for _, name := range e.LocaleNames() {
+		variants = append(variants, ConfigVariant{Label: "locale " + name, Config: e.ForLocale(name)})
+	}
+	if e.ABTest != nil {
+		for i := range e.ABTest.Variants {
+			variant := &e.ABTest.Variants[i]
+			variants = append(variants, ConfigVariant{Label: "variant " + variant.Name, Config: e.ForVariant(variant)})
+		}
+	}
+	return variants
+}
+
+// ForLocale returns the config as sent to receivers of the locale. Unknown
+// locales get the default content.
+func (e *EmailConfig) ForLocale(locale string) *EmailConfig {
+	content, ok := e.Locales[locale]
+	if !ok {
+		return e
+	}
+
+	variant := *e
+	if content.Subject != "" {
+		variant.Subject = content.Subject
+	}
+	if content.Body != "" {
+		variant.Body = content.Body
+	}
+	if content.Attachments != nil {
+		variant.Attachments = content.Attachments
+		variant.attachmentDir = e.LocaleAttachmentDir(locale)
+	}
+	return &variant
+}
+
+// ForReceiver picks the locale named in the receiver's locale column, e.g.
+// "vi" for "vi-VN" when only "vi" is configured, and returns the config for
+// it along with the locale the receiver got.
+func (e *EmailConfig) ForReceiver(receiver *Receiver) (*EmailConfig, string) {
+	if len(e.Locales) == 0 {
+		return e, e.DefaultLocaleName()
+	}
+
+	column := e.LocaleColumn
+	if column == "" {
+		column = DefaultLocaleColumn
+	}
+	value := strings.TrimSpace(receiver.Field(column))
+	if value == "" {
+		return e, e.DefaultLocaleName()
+	}
+
+	base, _, _ := strings.Cut(strings.ReplaceAll(value, "_", "-"), "-")
+	for _, candidate := range []string{value, base} {
+		for name := range e.Locales {
+			if strings.EqualFold(name, candidate) {
+				return e.ForLocale(name), name
+			}
+		}
+	}
+	return e, e.DefaultLocaleName()
+}
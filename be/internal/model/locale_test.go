@@ -0,0 +1,110 @@
+package model
+
+import "testing"
+
+func TestForReceiver(t *testing.T) {
+	config := &EmailConfig{
+		Subject: "Hello",
+		Body:    "Default body",
+		Locales: map[string]LocaleContent{
+			"vi":    {Subject: "Xin chào", Body: "Nội dung"},
+			"en-GB": {Body: "Colour"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		column     string
+		fields     map[string]string
+		wantLocale string
+		wantBody   string
+	}{
+		{"exact", "", map[string]string{"Language": "vi"}, "vi", "Nội dung"},
+		{"ignores case", "", map[string]string{"Language": "VI"}, "vi", "Nội dung"},
+		{"region falls back to base", "", map[string]string{"Language": "vi-VN"}, "vi", "Nội dung"},
+		{"underscore region", "", map[string]string{"Language": "vi_VN"}, "vi", "Nội dung"},
+		{"region configured", "", map[string]string{"Language": "en-GB"}, "en-GB", "Colour"},
+		{"other region", "", map[string]string{"Language": "en-US"}, "default", "Default body"},
+		{"unknown", "", map[string]string{"Language": "fr"}, "default", "Default body"},
+		{"empty", "", map[string]string{"Language": " "}, "default", "Default body"},
+		{"no column", "", nil, "default", "Default body"},
+		{"custom column", "Lang", map[string]string{"Lang": "vi-VN", "Language": "en-GB"}, "vi", "Nội dung"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *config
+			c.LocaleColumn = tt.column
+			got, locale := c.ForReceiver(&Receiver{Email: "a@example.com", Fields: tt.fields})
+			if locale != tt.wantLocale {
+				t.Errorf("locale = %q, want %q", locale, tt.wantLocale)
+			}
+			if got.Body != tt.wantBody {
+				t.Errorf("body = %q, want %q", got.Body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("keeps default subject", func(t *testing.T) {
+		got, _ := config.ForReceiver(&Receiver{Fields: map[string]string{"Language": "en-GB"}})
+		if got.Subject != "Hello" {
+			t.Errorf("subject = %q, want %q", got.Subject, "Hello")
+		}
+	})
+
+	t.Run("named default", func(t *testing.T) {
+		c := *config
+		c.DefaultLocale = "en"
+		if _, locale := c.ForReceiver(&Receiver{Fields: map[string]string{"Language": "fr"}}); locale != "en" {
+			t.Errorf("locale = %q, want %q", locale, "en")
+		}
+	})
+
+	t.Run("no locales", func(t *testing.T) {
+		plain := &EmailConfig{Body: "Default body"}
+		got, locale := plain.ForReceiver(&Receiver{Fields: map[string]string{"Language": "vi"}})
+		if got != plain || locale != "default" {
+			t.Errorf("got %p %q, want the config itself and %q", got, locale, "default")
+		}
+	})
+}
+
+func TestVariants(t *testing.T) {
+	config := &EmailConfig{
+		Subject: "Hello",
+		Body:    "Default body",
+		Locales: map[string]LocaleContent{
+			"vi": {Body: "Nội dung"},
+			"en": {Subject: "Hi"},
+		},
+		ABTest: &ABTest{Variants: []ABVariant{
+			{Name: "A", Percent: 50},
+			{Name: "B", Percent: 50, Subject: "Hey"},
+		}},
+	}
+
+	want := []struct {
+		label   string
+		subject string
+		body    string
+	}{
+		{"", "Hello", "Default body"},
+		{"locale en", "Hi", "Default body"},
+		{"locale vi", "Hello", "Nội dung"},
+		{"variant A", "Hello", "Default body"},
+		{"variant B", "Hey", "Default body"},
+	}
+
+	variants := config.Variants()
+	if len(variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(variants), len(want))
+	}
+	if variants[0].Config != config {
+		t.Error("first variant is not the config itself")
+	}
+	for i, w := range want {
+		got := variants[i]
+		if got.Label != w.label || got.Config.Subject != w.subject || got.Config.Body != w.body {
+			t.Errorf("variant %d = %q %q %q, want %q %q %q", i, got.Label, got.Config.Subject, got.Config.Body, w.label, w.subject, w.body)
+		}
+	}
+}
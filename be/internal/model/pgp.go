@@ -0,0 +1,159 @@
+package model
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const (
+	PGPPolicyOff     = "off"
+	PGPPolicyPrefer  = "prefer"
+	PGPPolicyRequire = "require"
+)
+
+// PGPKey describes a stored public key.
+type PGPKey struct {
+	Email       string    `json:"email"`
+	KeyID       string    `json:"key_id"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+	CanEncrypt  bool      `json:"can_encrypt"`
+}
+
+var pgpKeyDir = filepath.Join(os.TempDir(), "pgp", "keys")
+
+func pgpFileName(email string) string {
+	return safeFileName(strings.ToLower(strings.TrimSpace(email))) + ".asc"
+}
+
+func ValidPGPPolicy(policy string) bool {
+	switch policy {
+	case "", PGPPolicyOff, PGPPolicyPrefer, PGPPolicyRequire:
+		return true
+	}
+	return false
+}
+
+func describePGPKey(email string, entity *openpgp.Entity) PGPKey {
+	_, canEncrypt := entity.EncryptionKey(time.Now())
+	return PGPKey{
+		Email:       email,
+		KeyID:       strings.ToUpper(entity.PrimaryKey.KeyIdString()),
+		Fingerprint: strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)),
+		CreatedAt:   entity.PrimaryKey.CreationTime,
+		CanEncrypt:  canEncrypt,
+	}
+}
+
+// SavePGPKeys adds every public key of an armored key ring to the store,
+// once for each email address in its user IDs.
+func SavePGPKeys(armored []byte) ([]PGPKey, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read armored key: %w", err)
+	}
+	if err := os.MkdirAll(pgpKeyDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	var saved []PGPKey
+	for _, entity := range entities {
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			return saved, fmt.Errorf("failed to encode key: %w", err)
+		}
+		// Only the public part is kept even if a private key was uploaded
+		if err := entity.Serialize(w); err != nil {
+			return saved, fmt.Errorf("failed to encode key: %w", err)
+		}
+		w.Close()
+
+		for _, identity := range entity.Identities {
+			email := identity.UserId.Email
+			if address, err := mail.ParseAddress(identity.Name); email == "" && err == nil {
+				email = address.Address
+			}
+			if email == "" {
+				continue
+			}
+			email = strings.ToLower(email)
+			if err := os.WriteFile(filepath.Join(pgpKeyDir, pgpFileName(email)), buf.Bytes(), 0644); err != nil {
+				return saved, fmt.Errorf("failed to save key for %s: %w", email, err)
+			}
+			saved = append(saved, describePGPKey(email, entity))
+		}
+	}
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("no key with an email address found")
+	}
+	return saved, nil
+}
+
+// GetPGPKey returns the public key registered for an address, or nil when
+// there is none or it cannot be used for encryption.
+func GetPGPKey(email string) (*openpgp.Entity, error) {
+	data, err := os.ReadFile(filepath.Join(pgpKeyDir, pgpFileName(email)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil || len(entities) == 0 {
+		return nil, fmt.Errorf("invalid key for %s", email)
+	}
+	if _, ok := entities[0].EncryptionKey(time.Now()); !ok {
+		return nil, nil
+	}
+	return entities[0], nil
+}
+
+func ListPGPKeys() ([]PGPKey, error) {
+	entries, err := os.ReadDir(pgpKeyDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	var keys []PGPKey
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(pgpKeyDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil || len(entities) == 0 {
+			continue
+		}
+		keys = append(keys, describePGPKey(strings.TrimSuffix(entry.Name(), ".asc"), entities[0]))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Email < keys[j].Email
+	})
+	return keys, nil
+}
+
+func DeletePGPKey(email string) error {
+	if err := os.Remove(filepath.Join(pgpKeyDir, pgpFileName(email))); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no key for %s", email)
+		}
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+func useTempPGPStore(t *testing.T) {
+	t.Helper()
+	dir := pgpKeyDir
+	pgpKeyDir = t.TempDir()
+	t.Cleanup(func() { pgpKeyDir = dir })
+}
+
+// armoredPrivateKey returns a new key for the address with its private
+// part, as a user might upload by mistake.
+func armoredPrivateKey(t *testing.T, email string) []byte {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Receiver", "", email, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestSavePGPKeysKeepsOnlyPublicKeys(t *testing.T) {
+	useTempPGPStore(t)
+
+	saved, err := SavePGPKeys(armoredPrivateKey(t, "Receiver@Example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Email != "receiver@example.com" {
+		t.Fatalf("saved = %+v", saved)
+	}
+
+	key, err := GetPGPKey("receiver@example.com")
+	if err != nil || key == nil {
+		t.Fatalf("GetPGPKey() = %v, %v", key, err)
+	}
+	if key.PrivateKey != nil {
+		t.Errorf("private key was stored")
+	}
+	if key, err := GetPGPKey("other@example.com"); key != nil || err != nil {
+		t.Errorf("GetPGPKey(unknown) = %v, %v", key, err)
+	}
+}
+
+func TestSavePGPKeysRejectsInvalidInput(t *testing.T) {
+	useTempPGPStore(t)
+
+	if _, err := SavePGPKeys([]byte("not a key")); err == nil || !strings.Contains(err.Error(), "armored") {
+		t.Errorf("SavePGPKeys() = %v", err)
+	}
+}
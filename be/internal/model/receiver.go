@@ -2,6 +2,11 @@ package model
 
 import (
 	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/xuri/excelize/v2"
 )
 
@@ -11,6 +16,31 @@ type Receiver struct {
 	Owner string `json:"owner"`
 	Email string `json:"email"`
 	TaxID string `json:"tax_id"`
+	// Fields holds every column of the receiver's row keyed by its header
+	Fields map[string]string `json:"fields,omitempty"`
+	// Sheet and Row locate the receiver in the uploaded workbook, Row
+	// counting from 1 as shown by the spreadsheet, header row included
+	Sheet string `json:"sheet,omitempty"`
+	Row   int    `json:"row,omitempty"`
+}
+
+// ReceiverError reports a problem with one receiver row.
+type ReceiverError struct {
+	ID    string `json:"id"`
+	Sheet string `json:"sheet,omitempty"`
+	Row   int    `json:"row,omitempty"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+func NewReceiverError(receiver *Receiver, message string) ReceiverError {
+	return ReceiverError{
+		ID:    receiver.ID,
+		Sheet: receiver.Sheet,
+		Row:   receiver.Row,
+		Email: receiver.Email,
+		Error: message,
+	}
 }
 
 func (m *Receiver) PrintReceiver() {
@@ -21,14 +51,117 @@ func (m *Receiver) PrintReceiver() {
 	fmt.Println("TaxID:", m.TaxID)
 }
 
-const sheetName = "MainSheet"
+// Field returns the value of the named field, e.g. "TaxID" or "tax_id", or
+// of the spreadsheet column with that header.
+func (m *Receiver) Field(name string) string {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "")) {
+	case "id":
+		return m.ID
+	case "name":
+		return m.Name
+	case "owner":
+		return m.Owner
+	case "email":
+		return m.Email
+	case "taxid":
+		return m.TaxID
+	}
+	value, _ := m.Column(name)
+	return value
+}
+
+// Column looks up a spreadsheet column by header, ignoring case and
+// surrounding spaces when there is no exact match.
+func (m *Receiver) Column(header string) (string, bool) {
+	if value, ok := m.Fields[header]; ok {
+		return value, true
+	}
+	header = strings.TrimSpace(header)
+	for key, value := range m.Fields {
+		if strings.EqualFold(strings.TrimSpace(key), header) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*\.?([^{}]+?)\s*\}\}`)
 
-func GetReceiverFromSource(filepath string) ([]*Receiver, error) {
+// fillPlaceholders replaces {{Field}} (or {{.Field}}) in pattern with the
+// receiver's fields or columns, e.g. {{Due date}}, passing each value
+// through escape.
+func fillPlaceholders(pattern string, receiver *Receiver, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(pattern, func(match string) string {
+		field := placeholderPattern.FindStringSubmatch(match)[1]
+		return escape(strings.TrimSpace(receiver.Field(field)))
+	})
+}
+
+// safeFileName keeps a value from reaching outside its folder when used in
+// a file name.
+func safeFileName(value string) string {
+	value = strings.NewReplacer("/", "_", "\\", "_").Replace(value)
+	if value == "" || value == "." || value == ".." {
+		value = "_"
+	}
+	return value
+}
+
+// ListSheets returns the names of the workbook's sheets in tab order.
+func ListSheets(filepath string) ([]string, error) {
 	f, err := excelize.OpenFile(filepath)
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
+	defer f.Close()
+	return f.GetSheetList(), nil
+}
+
+// SelectSheets checks the requested sheets against the workbook. Without a
+// request the default sheet is used, or the first one when the workbook
+// has no sheet of that name.
+func SelectSheets(available, requested []string, defaultSheet string) ([]string, error) {
+	if len(available) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+	if len(requested) == 0 {
+		for _, name := range available {
+			if strings.EqualFold(name, defaultSheet) {
+				return []string{name}, nil
+			}
+		}
+		return available[:1], nil
+	}
+
+	var selected []string
+	for _, name := range requested {
+		found := false
+		for _, sheet := range available {
+			if strings.EqualFold(strings.TrimSpace(name), sheet) {
+				selected = append(selected, sheet)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("sheet %q not found, the workbook has %s", name, strings.Join(available, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// GetReceiverFromSource reads the receivers of the given sheets. The
+// receiver IDs are their sheet row, with more than one sheet prefixed with
+// the sheet name, e.g. "Hanoi:3", to keep them unique.
+//
+// The columns come from the given mapping, else from the mapping saved for
+// the sheet's layout, else from the headers; see ResolveLayout.
+func GetReceiverFromSource(filepath string, sheets []string, mapping *ColumnMapping) ([]*Receiver, []SheetLayout, error) {
+	f, err := excelize.OpenFile(filepath)
+	if err != nil {
+		fmt.Println(err)
+		return nil, nil, err
+	}
 	defer func() {
 		// Close the spreadsheet.
 		if err := f.Close(); err != nil {
@@ -36,64 +169,172 @@ func GetReceiverFromSource(filepath string) ([]*Receiver, error) {
 		}
 	}()
 
-	// Get all the rows in the Sheet2.
-	rows, err := f.GetRows(sheetName)
-	// Protectect that the first two rows are handlers
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+	var receivers []*Receiver
+	var layouts []SheetLayout
+	for _, sheet := range sheets {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			fmt.Println(err)
+			return nil, nil, err
+		}
+		if len(rows) == 0 {
+			log.Printf("Sheet %s is empty", sheet)
+			continue
+		}
+		layout, columns, err := ResolveLayout(rows[0], mapping)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sheet %s: %w", sheet, err)
+		}
+		layout.Sheet = sheet
+		layouts = append(layouts, *layout)
+
+		prefix := ""
+		if len(sheets) > 1 {
+			prefix = sheet + ":"
+		}
+		firstRow := 1
+		if layout.HasHeader {
+			rows = rows[1:]
+			firstRow = 2
+		}
+		for _, receiver := range receiversFromRows(rows, layout.Headers, columns, firstRow) {
+			receiver.ID = prefix + receiver.ID
+			receiver.Sheet = sheet
+			receivers = append(receivers, receiver)
+		}
 	}
-	if len(rows) < 2 {
-		fmt.Println("Not enough rows in the sheet")
-		return nil, fmt.Errorf("not enough rows in the sheet")
+	if len(receivers) == 0 {
+		return nil, layouts, fmt.Errorf("not enough rows in the sheet")
 	}
-	rows = rows[1:]
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+	log.Printf("Total receivers: %d", len(receivers))
+	return receivers, layouts, nil
+}
+
+// ResolveLayout works out the columns of a sheet from its first row and
+// returns the column index of every mapped field. A saved mapping for the
+// layout is preferred over the headers' synonyms. A sheet without any
+// recognised header falls back to the original Name, Owner, Email, TaxID
+// order, starting at the first row when it already holds an address.
+func ResolveLayout(firstRow []string, mapping *ColumnMapping) (*SheetLayout, map[string]int, error) {
+	layout := &SheetLayout{
+		Layout:    LayoutSignature(firstRow),
+		Headers:   columnNames(firstRow),
+		HasHeader: true,
 	}
-	var receivers []*Receiver
-	emailSet := make(map[string]bool)
-	for idx, row := range rows {
-		if len(row) < 4 {
-			continue
+
+	if mapping == nil {
+		saved, err := FindColumnMapping(layout.Layout)
+		if err != nil {
+			return nil, nil, err
 		}
+		mapping = saved
+	}
 
-		email := row[2]
-		// Skip if email is empty or already seen
-		if email == "" {
-			continue
+	detected := DetectColumns(layout.Headers)
+	switch {
+	case mapping != nil:
+		layout.MappingID = mapping.ID
+		layout.Columns = mapping.Columns
+	case detected[FieldEmail] != "":
+		layout.Columns = detected
+	default:
+		for _, value := range firstRow {
+			if strings.Contains(value, "@") {
+				// There is no header row to identify the layout by
+				layout.HasHeader = false
+				layout.Layout = ""
+				layout.Headers = columnNames(make([]string, len(firstRow)))
+				break
+			}
+		}
+		if len(layout.Headers) < 3 {
+			return nil, nil, fmt.Errorf("no email column found")
 		}
-		if emailSet[email] {
+		layout.Columns = make(map[string]string)
+		for i, field := range ReceiverFields {
+			if i < len(layout.Headers) {
+				layout.Columns[field] = layout.Headers[i]
+			}
+		}
+	}
+
+	columns := make(map[string]int, len(layout.Columns))
+	for field, header := range layout.Columns {
+		i := headerIndex(layout.Headers, header)
+		if i == -1 {
+			return nil, nil, fmt.Errorf("column %q of field %s not found", header, field)
+		}
+		columns[field] = i
+	}
+	if _, ok := columns[FieldEmail]; !ok {
+		return nil, nil, fmt.Errorf("no email column found")
+	}
+	return layout, columns, nil
+}
+
+// columnNames names the columns by header, or by letter when blank.
+func columnNames(headers []string) []string {
+	names := make([]string, len(headers))
+	for i, header := range headers {
+		names[i] = strings.TrimSpace(header)
+		if names[i] == "" {
+			names[i], _ = excelize.ColumnNumberToName(i + 1)
+		}
+	}
+	return names
+}
+
+// receiversFromRows reads the receivers of the rows, numbering them from
+// the sheet row of rows[0].
+func receiversFromRows(rows [][]string, headers []string, columns map[string]int, firstRow int) []*Receiver {
+	cell := func(row []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var receivers []*Receiver
+	for idx, row := range rows {
+		email := cell(row, FieldEmail)
+		// Rows without an email are skipped, repeated ones are kept
+		if email == "" {
 			continue
 		}
-		// emailSet[email] = true
 
 		var receiver Receiver
-		// Print index
-		receiver.ID = fmt.Sprintf("%d", idx+1)
-		receiver.Name = row[0]
-		receiver.Owner = row[1]
-		receiver.Email = row[2]
-		receiver.TaxID = row[3]
+		receiver.Row = firstRow + idx
+		receiver.ID = strconv.Itoa(receiver.Row)
+		receiver.Name = cell(row, FieldName)
+		receiver.Owner = cell(row, FieldOwner)
+		receiver.Email = email
+		receiver.TaxID = cell(row, FieldTaxID)
+		receiver.Fields = rowFields(headers, row)
 		receivers = append(receivers, &receiver)
-		fmt.Println()
 	}
-	fmt.Printf("Total unique receivers: %d\n", len(receivers))
-	return receivers, nil
+	return receivers
 }
 
-func (m *Receiver) GetReceiverAsJSON() string {
-	return fmt.Sprintf(`{"id": "%s", "name": "%s", "owner": "%s", "email": "%s", "tax_id": "%s"}`, m.ID, m.Name, m.Owner, m.Email, m.TaxID)
-}
-
-func EncodeReceiversToJSON(receivers []*Receiver) string {
-	var jsonStr string
-	for i, receiver := range receivers {
-		jsonStr += receiver.GetReceiverAsJSON()
-		if i < len(receivers)-1 {
-			jsonStr += ", "
+// rowFields maps every column with a header to its value in the row.
+// Columns without a header are named after their letter, e.g. "F".
+func rowFields(headers, row []string) map[string]string {
+	fields := make(map[string]string, len(headers))
+	for i := 0; i < len(headers) || i < len(row); i++ {
+		header := ""
+		if i < len(headers) {
+			header = strings.TrimSpace(headers[i])
+		}
+		if header == "" {
+			header, _ = excelize.ColumnNumberToName(i + 1)
+		}
+		value := ""
+		if i < len(row) {
+			value = row[i]
+		}
+		if _, ok := fields[header]; !ok {
+			fields[header] = value
 		}
 	}
-	return "[" + jsonStr + "]"
+	return fields
 }
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReceiverAttachments attaches a different file to every receiver. Files are
+// looked up in an uploaded zip archive, using a pattern such as
+// "{{TaxID}}.pdf" filled with the receiver's fields. The pattern may also
+// contain * and ? wildcards.
+type ReceiverAttachments struct {
+	ArchiveID string `json:"archive_id"`
+	Pattern   string `json:"pattern"`
+}
+
+var receiverArchiveDir = filepath.Join(os.TempDir(), "receiver_attachments")
+
+// maxReceiverArchiveSize caps the extracted size of an uploaded archive
+var maxReceiverArchiveSize int64 = 500 << 20
+
+const maxReceiverArchiveFiles = 10000
+
+// Dir returns the directory the attachment files are read from.
+func (r *ReceiverAttachments) Dir() string {
+	return filepath.Join(receiverArchiveDir, r.ArchiveID)
+}
+
+func (r *ReceiverAttachments) Validate() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("receiver attachment pattern is required")
+	}
+	if !IsID(r.ArchiveID) {
+		return fmt.Errorf("receiver attachments need an uploaded archive")
+	}
+	info, err := os.Stat(r.Dir())
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("receiver attachment archive %s not found", r.ArchiveID)
+	}
+	if _, err := filepath.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid receiver attachment pattern: %w", err)
+	}
+	if wildcardOnly(r.Pattern) {
+		return fmt.Errorf("receiver attachment pattern %s would match every file", r.Pattern)
+	}
+	return nil
+}
+
+// wildcardOnly reports whether a file name pattern matches any name, e.g.
+// "*" or "*.*".
+func wildcardOnly(pattern string) bool {
+	return strings.Trim(pattern, "*?.") == ""
+}
+
+// fileName fills the pattern placeholders with the receiver's fields.
+func (r *ReceiverAttachments) fileName(receiver *Receiver) string {
+	return fillPlaceholders(r.Pattern, receiver, safeFileName)
+}
+
+// Match returns the paths of the files matching the receiver, sorted by
+// name. File names are compared case-insensitively.
+func (r *ReceiverAttachments) Match(receiver *Receiver) ([]string, error) {
+	if !IsID(r.ArchiveID) {
+		return nil, fmt.Errorf("receiver attachment archive %s not found", r.ArchiveID)
+	}
+	// A receiver with empty fields must not get every file of the archive
+	if wildcardOnly(r.fileName(receiver)) {
+		return nil, fmt.Errorf("no value for attachment pattern %s", r.Pattern)
+	}
+	pattern := strings.ToLower(r.fileName(receiver))
+	entries, err := os.ReadDir(r.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receiver attachment folder: %w", err)
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ok, err := filepath.Match(pattern, strings.ToLower(entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("invalid receiver attachment pattern: %w", err)
+		}
+		if ok {
+			matches = append(matches, filepath.Join(r.Dir(), entry.Name()))
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no attachment matches %s", r.fileName(receiver))
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// CheckReceivers reports every receiver without a matching attachment.
+func (r *ReceiverAttachments) CheckReceivers(receivers []Receiver) []ReceiverError {
+	var errors []ReceiverError
+	for i := range receivers {
+		if _, err := r.Match(&receivers[i]); err != nil {
+			errors = append(errors, NewReceiverError(&receivers[i], err.Error()))
+		}
+	}
+	return errors
+}
+
+// SaveReceiverArchive extracts an uploaded zip archive and returns its ID
+// together with the names of the extracted files. Folders inside the
+// archive are flattened, so two files with the same name are rejected.
+func SaveReceiverArchive(r io.ReaderAt, size int64) (string, []string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	id := NewID()
+	dir := filepath.Join(receiverArchiveDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	var files []string
+	seen := make(map[string]string)
+	remaining := maxReceiverArchiveSize
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Base(filepath.FromSlash(strings.ReplaceAll(file.Name, "\\", "/")))
+		if name == "." || name == ".." || strings.HasPrefix(name, ".") {
+			continue
+		}
+		// Patterns are matched case-insensitively
+		if other, ok := seen[strings.ToLower(name)]; ok {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("archive contains %s more than once (%s and %s)", name, other, file.Name)
+		}
+		seen[strings.ToLower(name)] = file.Name
+		if len(seen) > maxReceiverArchiveFiles {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("archive contains more than %d files", maxReceiverArchiveFiles)
+		}
+
+		written, err := extractZipFile(file, filepath.Join(dir, name), remaining)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", nil, err
+		}
+		remaining -= written
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return id, files, nil
+}
+
+// extractZipFile writes one file of the archive, failing once more than
+// limit bytes have been extracted. The sizes in the zip headers are not
+// trusted.
+func extractZipFile(file *zip.File, path string, limit int64) (int64, error) {
+	src, err := file.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s from archive: %w", file.Name, err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", filepath.Base(path), err)
+	}
+	defer dst.Close()
+
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return written, fmt.Errorf("failed to extract %s: %w", file.Name, err)
+	}
+	if written > limit {
+		return written, fmt.Errorf("archive is larger than %d MB when extracted", maxReceiverArchiveSize>>20)
+	}
+	return written, nil
+}
+
+// ListReceiverArchive returns the names of the files in an uploaded archive.
+func ListReceiverArchive(id string) ([]string, error) {
+	if !IsID(id) {
+		return nil, fmt.Errorf("archive %s not found", id)
+	}
+	entries, err := os.ReadDir(filepath.Join(receiverArchiveDir, id))
+	if err != nil {
+		return nil, fmt.Errorf("archive %s not found", id)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useTempArchiveStore(t *testing.T) {
+	t.Helper()
+	dir := receiverArchiveDir
+	receiverArchiveDir = t.TempDir()
+	t.Cleanup(func() { receiverArchiveDir = dir })
+}
+
+func zipArchive(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestSaveReceiverArchive(t *testing.T) {
+	useTempArchiveStore(t)
+
+	archive := zipArchive(t, map[string]string{
+		"invoices/0101.pdf": "a",
+		"0102.pdf":          "b",
+		"__MACOSX/.0101":    "ignored",
+	})
+	id, files, err := SaveReceiverArchive(archive, archive.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(files, ",") != "0101.pdf,0102.pdf" {
+		t.Errorf("files = %v", files)
+	}
+
+	attachments := ReceiverAttachments{ArchiveID: id, Pattern: "{{TaxID}}.pdf"}
+	if err := attachments.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := attachments.Match(&Receiver{TaxID: "0102"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "0102.pdf" {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+func TestSaveReceiverArchiveRejects(t *testing.T) {
+	useTempArchiveStore(t)
+	limit := maxReceiverArchiveSize
+	maxReceiverArchiveSize = 10
+	t.Cleanup(func() { maxReceiverArchiveSize = limit })
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"duplicate after flattening", map[string]string{"a/0101.pdf": "1", "b/0101.pdf": "2"}, "more than once"},
+		{"duplicate ignoring case", map[string]string{"0101.PDF": "1", "0101.pdf": "2"}, "more than once"},
+		{"too large", map[string]string{"a.pdf": "123456", "b.pdf": "123456"}, "larger than"},
+	}
+	for _, tt := range tests {
+		archive := zipArchive(t, tt.files)
+		_, _, err := SaveReceiverArchive(archive, archive.Size())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Rejected archives leave nothing behind
+	entries, _ := os.ReadDir(receiverArchiveDir)
+	if len(entries) != 0 {
+		t.Errorf("%d archive directories left", len(entries))
+	}
+}
+
+func TestReceiverAttachmentsValidate(t *testing.T) {
+	useTempArchiveStore(t)
+	archive := zipArchive(t, map[string]string{"0101.pdf": "a"})
+	id, _, err := SaveReceiverArchive(archive, archive.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  ReceiverAttachments
+		wantErr bool
+	}{
+		{"pattern", ReceiverAttachments{ArchiveID: id, Pattern: "{{TaxID}}*.pdf"}, false},
+		{"wildcard only", ReceiverAttachments{ArchiveID: id, Pattern: "*"}, true},
+		{"any extension", ReceiverAttachments{ArchiveID: id, Pattern: "*.*"}, true},
+		{"no archive", ReceiverAttachments{Pattern: "{{TaxID}}.pdf"}, true},
+		{"path as archive", ReceiverAttachments{ArchiveID: "../../etc", Pattern: "{{TaxID}}"}, true},
+		{"unknown archive", ReceiverAttachments{ArchiveID: "0123456789abcdef", Pattern: "{{TaxID}}"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// An empty field must not turn the pattern into a match-all
+	attachments := ReceiverAttachments{ArchiveID: id, Pattern: "{{TaxID}}*"}
+	if paths, err := attachments.Match(&Receiver{}); err == nil {
+		t.Errorf("Match with empty tax ID = %v, want an error", paths)
+	}
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FilterEquals    = "eq"
+	FilterNotEquals = "ne"
+	FilterContains  = "contains"
+	FilterEmpty     = "empty"
+	FilterNotEmpty  = "not_empty"
+)
+
+// ReceiverFilter selects receivers by one of their fields or spreadsheet
+// columns, e.g. {"column": "Region", "op": "eq", "value": "North"}. Values
+// are compared ignoring case and surrounding spaces.
+type ReceiverFilter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  string `json:"value,omitempty"`
+}
+
+func (f *ReceiverFilter) Validate() error {
+	if strings.TrimSpace(f.Column) == "" {
+		return fmt.Errorf("filter column is required")
+	}
+	switch f.Op {
+	case FilterEquals, FilterNotEquals, FilterContains, FilterEmpty, FilterNotEmpty:
+	default:
+		return fmt.Errorf("filter operator must be eq, ne, contains, empty or not_empty")
+	}
+	return nil
+}
+
+// Match reports whether the receiver passes the filter.
+func (f *ReceiverFilter) Match(receiver *Receiver) bool {
+	value := strings.ToLower(strings.TrimSpace(receiver.Field(f.Column)))
+	want := strings.ToLower(strings.TrimSpace(f.Value))
+	switch f.Op {
+	case FilterEquals:
+		return value == want
+	case FilterNotEquals:
+		return value != want
+	case FilterContains:
+		return strings.Contains(value, want)
+	case FilterEmpty:
+		return value == ""
+	case FilterNotEmpty:
+		return value != ""
+	}
+	return false
+}
+
+// FilterReceivers keeps the receivers that pass every filter. A filter on a
+// column that no receiver has is an error rather than a silent match.
+func FilterReceivers(receivers []Receiver, filters []ReceiverFilter) ([]Receiver, error) {
+	for i := range filters {
+		if err := filters[i].Validate(); err != nil {
+			return nil, err
+		}
+		if !hasColumn(receivers, filters[i].Column) {
+			return nil, fmt.Errorf("filter column %s not found", filters[i].Column)
+		}
+	}
+	if len(filters) == 0 {
+		return receivers, nil
+	}
+
+	var kept []Receiver
+	for i := range receivers {
+		matched := true
+		for j := range filters {
+			if !filters[j].Match(&receivers[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			kept = append(kept, receivers[i])
+		}
+	}
+	return kept, nil
+}
+
+func hasColumn(receivers []Receiver, column string) bool {
+	switch strings.ToLower(strings.ReplaceAll(column, "_", "")) {
+	case "id", "name", "owner", "email", "taxid":
+		return true
+	}
+	for i := range receivers {
+		if _, ok := receivers[i].Column(column); ok {
+			return true
+		}
+	}
+	return len(receivers) == 0
+}
@@ -0,0 +1,51 @@
+package model
+
+import "testing"
+
+func TestFilterReceivers(t *testing.T) {
+	receivers := []Receiver{
+		{ID: "2", Email: "a@example.com", Fields: map[string]string{"Region": "North", "Due date": "05/03"}},
+		{ID: "3", Email: "b@example.org", Fields: map[string]string{"Region": " north ", "Due date": ""}},
+		{ID: "4", Email: "c@example.com", Fields: map[string]string{"Region": "South"}},
+	}
+
+	tests := []struct {
+		name    string
+		filters []ReceiverFilter
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, []string{"2", "3", "4"}, false},
+		{"equals ignores case and spaces", []ReceiverFilter{{Column: "region", Op: FilterEquals, Value: "NORTH"}}, []string{"2", "3"}, false},
+		{"not equals", []ReceiverFilter{{Column: "Region", Op: FilterNotEquals, Value: "north"}}, []string{"4"}, false},
+		{"contains builtin", []ReceiverFilter{{Column: "email", Op: FilterContains, Value: "example.com"}}, []string{"2", "4"}, false},
+		{"empty", []ReceiverFilter{{Column: "Due date", Op: FilterEmpty}}, []string{"3", "4"}, false},
+		{"all filters", []ReceiverFilter{
+			{Column: "Region", Op: FilterEquals, Value: "north"},
+			{Column: "Due date", Op: FilterNotEmpty},
+		}, []string{"2"}, false},
+		{"unknown column", []ReceiverFilter{{Column: "Regoin", Op: FilterEquals, Value: "north"}}, nil, true},
+		{"unknown operator", []ReceiverFilter{{Column: "Region", Op: "like"}}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := FilterReceivers(receivers, tt.filters)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		var ids []string
+		for _, receiver := range got {
+			ids = append(ids, receiver.ID)
+		}
+		if len(ids) != len(tt.want) {
+			t.Errorf("%s: receivers = %v, want %v", tt.name, ids, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("%s: receivers = %v, want %v", tt.name, ids, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func useTempColumnMappingStore(t *testing.T) {
+	t.Helper()
+	dir := columnMappingDir
+	columnMappingDir = t.TempDir()
+	t.Cleanup(func() { columnMappingDir = dir })
+}
+
+// writeWorkbook saves the sheets, each a list of rows, as an xlsx file.
+func writeWorkbook(t *testing.T, sheets map[string][][]string) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for name, rows := range sheets {
+		if _, err := f.NewSheet(name); err != nil {
+			t.Fatal(err)
+		}
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			values := make([]any, len(row))
+			for j := range row {
+				values[j] = row[j]
+			}
+			if err := f.SetSheetRow(name, cell, &values); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "receivers.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetReceiverFromSourceRows(t *testing.T) {
+	useTempColumnMappingStore(t)
+	path := writeWorkbook(t, map[string][][]string{
+		"Hanoi": {
+			{"Name", "Email", "Due date"},
+			{"An", "an@example.com", "05/03"},
+			{"No address", "", ""},
+			{"Binh", "binh@example.com", ""},
+		},
+		"Hue": {
+			{"Chi", "chi@example.com", "x"},
+			{"Dung", "dung@example.com", "y"},
+		},
+	})
+
+	receivers, _, err := GetReceiverFromSource(path, []string{"Hanoi", "Hue"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		id    string
+		sheet string
+		row   int
+	}{
+		// The header is row 1 and the row without an address is skipped
+		{"Hanoi:2", "Hanoi", 2},
+		{"Hanoi:4", "Hanoi", 4},
+		// A sheet without a header starts at row 1
+		{"Hue:1", "Hue", 1},
+		{"Hue:2", "Hue", 2},
+	}
+	if len(receivers) != len(want) {
+		t.Fatalf("got %d receivers, want %d", len(receivers), len(want))
+	}
+	for i, w := range want {
+		r := receivers[i]
+		if r.ID != w.id || r.Sheet != w.sheet || r.Row != w.row {
+			t.Errorf("receiver %d = %s %s row %d, want %s %s row %d", i, r.ID, r.Sheet, r.Row, w.id, w.sheet, w.row)
+		}
+	}
+
+	rowErr := NewReceiverError(receivers[1], "missing")
+	if rowErr.Row != 4 || rowErr.Sheet != "Hanoi" || rowErr.ID != "Hanoi:4" {
+		t.Errorf("error = %+v", rowErr)
+	}
+}
@@ -0,0 +1,265 @@
+package model
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SMIMEOptions turns on S/MIME for a campaign. Signing uses the identity
+// of the sender, encryption happens for every receiver whose certificate
+// is in the certificate store.
+type SMIMEOptions struct {
+	Sign    bool `json:"sign"`
+	Encrypt bool `json:"encrypt"`
+}
+
+// SMIMECertificate describes a stored certificate.
+type SMIMECertificate struct {
+	Email       string    `json:"email"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// SMIMEIdentity is the certificate and key a sender signs with.
+type SMIMEIdentity struct {
+	Certificate *x509.Certificate
+	Chain       []*x509.Certificate
+	PrivateKey  crypto.PrivateKey
+}
+
+var smimeIdentityDir = filepath.Join(os.TempDir(), "smime", "identities")
+var smimeCertificateDir = filepath.Join(os.TempDir(), "smime", "certificates")
+
+// oidEmailAddress is the legacy emailAddress attribute of a subject name
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+func smimeFileName(email string) string {
+	return safeFileName(strings.ToLower(strings.TrimSpace(email))) + ".pem"
+}
+
+func describeCertificate(email string, cert *x509.Certificate) SMIMECertificate {
+	sum := sha256.Sum256(cert.Raw)
+	return SMIMECertificate{
+		Email:       email,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    cert.NotAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// certificateEmails returns the addresses a certificate is issued for.
+func certificateEmails(cert *x509.Certificate) []string {
+	emails := append([]string{}, cert.EmailAddresses...)
+	for _, name := range cert.Subject.Names {
+		if name.Type.Equal(oidEmailAddress) {
+			if email, ok := name.Value.(string); ok {
+				emails = append(emails, email)
+			}
+		}
+	}
+	return emails
+}
+
+// checkSigningCertificate returns an error unless the certificate is valid
+// at now and issued for the sender's address.
+func checkSigningCertificate(cert *x509.Certificate, sender string, now time.Time) error {
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %s is only valid from %s to %s", cert.Subject, cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+	}
+	address := sender
+	if parsed, err := mail.ParseAddress(sender); err == nil {
+		address = parsed.Address
+	}
+	emails := certificateEmails(cert)
+	for _, email := range emails {
+		if strings.EqualFold(email, address) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate is issued for %s, not for the sender %s", strings.Join(emails, ", "), address)
+}
+
+// CheckSender returns an error unless the identity can sign mail from the
+// sender now.
+func (i *SMIMEIdentity) CheckSender(sender string) error {
+	return checkSigningCertificate(i.Certificate, sender, time.Now())
+}
+
+// SaveSMIMEIdentity stores the signing certificate (optionally followed by
+// its chain) and private key of a sender, both PEM encoded. The certificate
+// must be valid and issued for the sender's address.
+func SaveSMIMEIdentity(email string, certPEM, keyPEM []byte) (*SMIMECertificate, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("certificate and key do not form a valid pair: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if err := checkSigningCertificate(cert, email, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(smimeIdentityDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create identity directory: %w", err)
+	}
+	data := append(append([]byte{}, certPEM...), keyPEM...)
+	if err := os.WriteFile(filepath.Join(smimeIdentityDir, smimeFileName(email)), data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save identity: %w", err)
+	}
+
+	info := describeCertificate(email, cert)
+	return &info, nil
+}
+
+// GetSMIMEIdentity returns the signing identity of a sender, or nil if the
+// sender has none.
+func GetSMIMEIdentity(email string) (*SMIMEIdentity, error) {
+	data, err := os.ReadFile(filepath.Join(smimeIdentityDir, smimeFileName(email)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	pair, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity: %w", err)
+	}
+	identity := SMIMEIdentity{PrivateKey: pair.PrivateKey}
+	for i, der := range pair.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if i == 0 {
+			identity.Certificate = cert
+		} else {
+			identity.Chain = append(identity.Chain, cert)
+		}
+	}
+	return &identity, nil
+}
+
+func DeleteSMIMEIdentity(email string) error {
+	if err := os.Remove(filepath.Join(smimeIdentityDir, smimeFileName(email))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	return nil
+}
+
+// SaveSMIMECertificates adds every certificate of a PEM bundle to the
+// store, once for each email address it is issued for.
+func SaveSMIMECertificates(bundle []byte) ([]SMIMECertificate, error) {
+	if err := os.MkdirAll(smimeCertificateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	var saved []SMIMECertificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return saved, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+
+		emails := certificateEmails(cert)
+		if len(emails) == 0 {
+			return saved, fmt.Errorf("certificate %s has no email address", cert.Subject)
+		}
+		for _, email := range emails {
+			path := filepath.Join(smimeCertificateDir, smimeFileName(email))
+			if err := os.WriteFile(path, pem.EncodeToMemory(block), 0644); err != nil {
+				return saved, fmt.Errorf("failed to save certificate for %s: %w", email, err)
+			}
+			saved = append(saved, describeCertificate(strings.ToLower(email), cert))
+		}
+	}
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return saved, nil
+}
+
+// GetSMIMECertificate returns the certificate of a receiver, or nil when
+// the store has no valid certificate for the address.
+func GetSMIMECertificate(email string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(smimeCertificateDir, smimeFileName(email)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid certificate for %s", email)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate for %s: %w", email, err)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, nil
+	}
+	return cert, nil
+}
+
+func ListSMIMECertificates() ([]SMIMECertificate, error) {
+	entries, err := os.ReadDir(smimeCertificateDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read certificate directory: %w", err)
+	}
+
+	var certificates []SMIMECertificate
+	for _, entry := range entries {
+		email := strings.TrimSuffix(entry.Name(), ".pem")
+		cert, err := GetSMIMECertificate(email)
+		if err != nil || cert == nil {
+			continue
+		}
+		certificates = append(certificates, describeCertificate(email, cert))
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		return certificates[i].Email < certificates[j].Email
+	})
+	return certificates, nil
+}
+
+func DeleteSMIMECertificate(email string) error {
+	if err := os.Remove(filepath.Join(smimeCertificateDir, smimeFileName(email))); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no certificate for %s", email)
+		}
+		return fmt.Errorf("failed to delete certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useTempSMIMEStore(t *testing.T) {
+	t.Helper()
+	identities, certificates := smimeIdentityDir, smimeCertificateDir
+	smimeIdentityDir, smimeCertificateDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { smimeIdentityDir, smimeCertificateDir = identities, certificates })
+}
+
+// testCertificate returns a self-signed PEM certificate and key for the
+// address, valid from notBefore to notAfter.
+func testCertificate(t *testing.T, email string, notBefore, notAfter time.Time) ([]byte, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: email},
+		EmailAddresses: []string{email},
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM
+}
+
+func TestSaveSMIMEIdentity(t *testing.T) {
+	useTempSMIMEStore(t)
+	now := time.Now()
+	certPEM, keyPEM := testCertificate(t, "sender@example.com", now.Add(-time.Hour), now.Add(24*time.Hour))
+	expiredPEM, expiredKeyPEM := testCertificate(t, "sender@example.com", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	_, otherKeyPEM := testCertificate(t, "sender@example.com", now.Add(-time.Hour), now.Add(24*time.Hour))
+
+	tests := []struct {
+		name    string
+		email   string
+		cert    []byte
+		key     []byte
+		wantErr string
+	}{
+		{"valid", "Sender@Example.com", certPEM, keyPEM, ""},
+		{"expired", "sender@example.com", expiredPEM, expiredKeyPEM, "only valid from"},
+		{"key of another certificate", "sender@example.com", certPEM, otherKeyPEM, "valid pair"},
+		{"other sender", "someone@example.com", certPEM, keyPEM, "not for the sender"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SaveSMIMEIdentity(tt.email, tt.cert, tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				identity, err := GetSMIMEIdentity(tt.email)
+				if err != nil || identity == nil {
+					t.Fatalf("GetSMIMEIdentity() = %v, %v", identity, err)
+				}
+				if err := identity.CheckSender("Sender <sender@example.com>"); err != nil {
+					t.Errorf("CheckSender() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SaveSMIMEIdentity() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetSMIMECertificateSkipsExpired(t *testing.T) {
+	useTempSMIMEStore(t)
+	now := time.Now()
+	valid, _ := testCertificate(t, "a@example.com", now.Add(-time.Hour), now.Add(time.Hour))
+	expired, _ := testCertificate(t, "b@example.com", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if _, err := SaveSMIMECertificates(append(valid, expired...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if cert, err := GetSMIMECertificate("A@example.com"); err != nil || cert == nil {
+		t.Errorf("GetSMIMECertificate(a) = %v, %v", cert, err)
+	}
+	if cert, err := GetSMIMECertificate("b@example.com"); err != nil || cert != nil {
+		t.Errorf("GetSMIMECertificate(b) = %v, %v, want none", cert, err)
+	}
+}
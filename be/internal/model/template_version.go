@@ -0,0 +1,368 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TemplateVersion describes one saved version of a template. Versions are
+// never changed once written; restoring an old one saves it as a new
+// version.
+type TemplateVersion struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TemplateChange is a difference between two versions. Multi-line text is
+// compared line by line, other fields by value.
+type TemplateChange struct {
+	Field string     `json:"field"`
+	Old   string     `json:"old,omitempty"`
+	New   string     `json:"new,omitempty"`
+	Lines []DiffLine `json:"lines,omitempty"`
+}
+
+// DiffLine is a line of a line diff, Op is " ", "-" or "+".
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+func templateVersionDir(id string) string {
+	return filepath.Join(filepath.Dir(templatePath(id)), "versions")
+}
+
+func templateVersionPath(id string, version int) string {
+	return filepath.Join(templateVersionDir(id), fmt.Sprintf("%d.json", version))
+}
+
+// latestTemplateVersion returns the highest version in the template's
+// history, 0 when it has none.
+func latestTemplateVersion(id string) (int, error) {
+	entries, err := os.ReadDir(templateVersionDir(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read version directory: %w", err)
+	}
+	latest := 0
+	for _, entry := range entries {
+		if version, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// ensureFirstVersion gives a template saved before versions were kept its
+// version 1, so that its history starts with the content it has now.
+func ensureFirstVersion(config *EmailConfig) error {
+	if config.ID == "" || config.Version > 0 {
+		return nil
+	}
+	config.Version = 1
+	if _, err := os.Stat(templateVersionPath(config.ID, 1)); os.IsNotExist(err) {
+		if err := writeJSONFile(templateVersionPath(config.ID, 1), config); err != nil {
+			return err
+		}
+	}
+	return writeJSONFile(templatePath(config.ID), config)
+}
+
+// saveTemplateVersion keeps a copy of the template as just saved.
+func saveTemplateVersion(config *EmailConfig) error {
+	path := templateVersionPath(config.ID, config.Version)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("version %d of template %s already exists", config.Version, config.ID)
+	}
+	return writeJSONFile(path, config)
+}
+
+// ListTemplateVersions returns the versions of a template, newest first.
+func ListTemplateVersions(id string) ([]TemplateVersion, error) {
+	if !validTemplateID(id) {
+		return nil, fmt.Errorf("template %s not found", id)
+	}
+
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+
+	var current EmailConfig
+	if err := readJSONFile(templatePath(id), &current); err != nil {
+		return nil, err
+	}
+	if err := ensureFirstVersion(&current); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(templateVersionDir(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("template %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to read version directory: %w", err)
+	}
+
+	var versions []TemplateVersion
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err != nil {
+			continue
+		}
+		var config EmailConfig
+		if err := readJSONFile(filepath.Join(templateVersionDir(id), entry.Name()), &config); err != nil {
+			return nil, err
+		}
+		versions = append(versions, TemplateVersion{
+			Version:   config.Version,
+			Name:      config.Name,
+			Subject:   config.Subject,
+			Author:    config.UpdatedBy,
+			CreatedAt: config.UpdatedAt,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	return versions, nil
+}
+
+// GetTemplateVersion returns the template as it was saved in a version.
+func GetTemplateVersion(id string, version int) (*EmailConfig, error) {
+	if !validTemplateID(id) {
+		return nil, fmt.Errorf("template %s not found", id)
+	}
+
+	emailConfigMu.Lock()
+	defer emailConfigMu.Unlock()
+
+	var current EmailConfig
+	if err := readJSONFile(templatePath(id), &current); err != nil {
+		return nil, err
+	}
+	if err := ensureFirstVersion(&current); err != nil {
+		return nil, err
+	}
+
+	var config EmailConfig
+	if err := readJSONFile(templateVersionPath(id, version), &config); err != nil {
+		return nil, err
+	}
+	if config.ID == "" {
+		return nil, fmt.Errorf("version %d of template %s not found", version, id)
+	}
+	config.defaultContentType()
+	return &config, nil
+}
+
+// RestoreTemplateVersion saves an old version as the newest one.
+func RestoreTemplateVersion(id string, version int, author string) (*EmailConfig, error) {
+	config, err := GetTemplateVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveEmailConfig(config, author); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DiffTemplates lists the fields that differ between two versions. Version
+// bookkeeping is ignored and attachments are compared by content hash.
+func DiffTemplates(from, to *EmailConfig) ([]TemplateChange, error) {
+	oldFields, err := diffFields(from)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := diffFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for key := range oldFields {
+		keys[key] = true
+	}
+	for key := range newFields {
+		keys[key] = true
+	}
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var changes []TemplateChange
+	for _, field := range names {
+		oldValue, newValue := fieldText(oldFields[field]), fieldText(newFields[field])
+		if oldValue == newValue {
+			continue
+		}
+		change := TemplateChange{Field: field}
+		if strings.Contains(oldValue, "\n") || strings.Contains(newValue, "\n") {
+			change.Lines = DiffLines(oldValue, newValue)
+		} else {
+			change.Old, change.New = oldValue, newValue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// diffFields returns the top-level JSON fields of a template without the
+// ones that change on every save.
+func diffFields(config *EmailConfig) (map[string]json.RawMessage, error) {
+	snapshot := *config
+	snapshot.Attachments = hashAttachments(config.Attachments)
+	if config.Locales != nil {
+		snapshot.Locales = make(map[string]LocaleContent, len(config.Locales))
+		for locale, content := range config.Locales {
+			content.Attachments = hashAttachments(content.Attachments)
+			snapshot.Locales[locale] = content
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize template: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to serialize template: %w", err)
+	}
+	for _, key := range []string{"id", "version", "created_at", "updated_at", "updated_by"} {
+		delete(fields, key)
+	}
+	return fields, nil
+}
+
+// hashAttachments replaces the content of attachments with its hash so
+// that diffs stay readable.
+func hashAttachments(attachments []Attachment) []Attachment {
+	if attachments == nil {
+		return nil
+	}
+	hashed := make([]Attachment, len(attachments))
+	for i, attachment := range attachments {
+		sum := sha256.Sum256([]byte(attachment.Data))
+		attachment.Data = "sha256:" + hex.EncodeToString(sum[:])
+		hashed[i] = attachment
+	}
+	return hashed
+}
+
+// fieldText shows strings as they are and anything else as indented JSON.
+func fieldText(raw json.RawMessage) string {
+	if raw == nil {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	if v == nil {
+		return ""
+	}
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+// maxDiffCells bounds the table DiffLines allocates, one int per pair of
+// changed lines.
+const maxDiffCells = 1 << 20
+
+// DiffLines compares two texts line by line using their longest common
+// subsequence. Lines shared at the start and end are matched first; when
+// what is left between them is too large to compare, the old lines are
+// all shown as removed and the new ones as added.
+func DiffLines(oldText, newText string) []DiffLine {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for _, line := range a[:prefix] {
+		lines = append(lines, DiffLine{Op: " ", Text: line})
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{Op: " ", Text: line})
+	}
+	return lines
+}
+
+// diffMiddle compares the lines left once the common start and end are
+// removed.
+func diffMiddle(a, b []string) []DiffLine {
+	var lines []DiffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			lines = append(lines, DiffLine{Op: "-", Text: line})
+		}
+		for _, line := range b {
+			lines = append(lines, DiffLine{Op: "+", Text: line})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
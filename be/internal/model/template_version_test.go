@@ -0,0 +1,129 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{"equal", "a\nb", "a\nb", " a| b"},
+		{"added", "a\nc", "a\nb\nc", " a|+b| c"},
+		{"removed", "a\nb\nc", "a\nc", " a|-b| c"},
+		{"changed", "a\nb\nc", "a\nx\nc", " a|-b|+x| c"},
+		{"appended", "a", "a\nb", " a|+b"},
+		{"from empty", "", "a", "-|+a"},
+		{"all different", "a\nb", "c", "-a|-b|+c"},
+		{"repeated line", "a\na", "a\na\na", " a| a|+a"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, line := range DiffLines(tt.old, tt.new) {
+			got = append(got, line.Op+line.Text)
+		}
+		if strings.Join(got, "|") != tt.want {
+			t.Errorf("%s: DiffLines = %q, want %q", tt.name, strings.Join(got, "|"), tt.want)
+		}
+	}
+}
+
+func TestDiffLinesLargeInput(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 2000; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("old %d", i))
+		newLines = append(newLines, fmt.Sprintf("new %d", i))
+	}
+	oldText := "head\n" + strings.Join(oldLines, "\n") + "\ntail"
+	newText := "head\n" + strings.Join(newLines, "\n") + "\ntail"
+
+	lines := DiffLines(oldText, newText)
+	if len(lines) != 2+len(oldLines)+len(newLines) {
+		t.Fatalf("got %d lines, want %d", len(lines), 2+len(oldLines)+len(newLines))
+	}
+	if lines[0] != (DiffLine{Op: " ", Text: "head"}) || lines[len(lines)-1] != (DiffLine{Op: " ", Text: "tail"}) {
+		t.Errorf("common lines not kept: first %v, last %v", lines[0], lines[len(lines)-1])
+	}
+	for i, line := range lines[1 : len(lines)-1] {
+		want := "-"
+		if i >= len(oldLines) {
+			want = "+"
+		}
+		if line.Op != want {
+			t.Fatalf("line %d = %q, want op %q", i+1, line.Op+line.Text, want)
+		}
+	}
+}
+
+func TestTemplateWithoutVersionGetsVersionOne(t *testing.T) {
+	useTempTemplateStore(t)
+
+	// Saved by the template library before versions were kept
+	stored := map[string]any{"id": "abc", "name": "Old", "subject": "Hello", "body": "Hi"}
+	if err := writeJSONFile(templatePath("abc"), stored); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := ListTemplateVersions("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("versions = %+v", versions)
+	}
+
+	config, err := GetEmailConfig("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != 1 {
+		t.Errorf("version = %d, want 1", config.Version)
+	}
+	config.Body = "Hi again"
+	if err := SaveEmailConfig(config, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != 2 {
+		t.Errorf("version after save = %d, want 2", config.Version)
+	}
+	first, err := GetTemplateVersion("abc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Body != "Hi" {
+		t.Errorf("version 1 body = %q, want the original", first.Body)
+	}
+}
+
+func TestSaveAfterFailedTemplateWrite(t *testing.T) {
+	useTempTemplateStore(t)
+
+	config := EmailConfig{Name: "T", Subject: "Hello", Body: "one", ContentType: ContentTypeText}
+	if err := SaveEmailConfig(&config, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 2 was written but the template itself was not
+	orphan := config
+	orphan.Version = 2
+	orphan.Body = "lost"
+	if err := saveTemplateVersion(&orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Body = "three"
+	if err := SaveEmailConfig(&config, "tester"); err != nil {
+		t.Fatalf("save after orphaned version: %v", err)
+	}
+	if config.Version != 3 {
+		t.Errorf("version = %d, want 3", config.Version)
+	}
+	if err := SaveEmailConfig(&config, "tester"); err != nil || config.Version != 4 {
+		t.Errorf("next save = version %d, %v", config.Version, err)
+	}
+}
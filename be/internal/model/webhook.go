@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the deliveries. It is never sent back to clients, which
+	// only see HasSecret.
+	Secret    string    `json:"-"`
+	HasSecret bool      `json:"has_secret"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// webhookRecord is a webhook as stored, with its secret.
+type webhookRecord struct {
+	Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Payload    string    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+var webhookDir = filepath.Join(os.TempDir(), "webhooks")
+var webhookFileName = "webhooks.json"
+var webhookDeliveryFileName = "failed_deliveries.json"
+
+// Only the most recent failed deliveries are kept in the log
+const maxWebhookDeliveries = 500
+
+var webhookMu sync.Mutex
+
+// The webhooks are read once and kept in sync by SaveWebhook and
+// DeleteWebhook, since every dispatched event needs them
+var webhookCache []Webhook
+var webhookCacheLoaded bool
+
+// Subscribed reports whether the webhook wants to receive the given event.
+// A webhook without any events listed receives all of them.
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWebhooks returns the cached webhooks, reading them on first use. The
+// caller holds webhookMu.
+func loadWebhooks() ([]Webhook, error) {
+	if webhookCacheLoaded {
+		return webhookCache, nil
+	}
+	var records []webhookRecord
+	if err := readJSONFile(filepath.Join(webhookDir, webhookFileName), &records); err != nil {
+		return nil, err
+	}
+	webhooks := make([]Webhook, 0, len(records))
+	for _, record := range records {
+		webhook := record.Webhook
+		webhook.Secret = record.Secret
+		webhook.HasSecret = record.Secret != ""
+		webhooks = append(webhooks, webhook)
+	}
+	webhookCache, webhookCacheLoaded = webhooks, true
+	return webhooks, nil
+}
+
+// storeWebhooks writes the webhooks and replaces the cache. The caller
+// holds webhookMu.
+func storeWebhooks(webhooks []Webhook) error {
+	records := make([]webhookRecord, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		webhook.HasSecret = webhook.Secret != ""
+		records = append(records, webhookRecord{Webhook: webhook, Secret: webhook.Secret})
+	}
+	if err := writeJSONFile(filepath.Join(webhookDir, webhookFileName), records); err != nil {
+		return err
+	}
+	webhookCache = webhooks
+	for i := range webhookCache {
+		webhookCache[i].HasSecret = webhookCache[i].Secret != ""
+	}
+	return nil
+}
+
+func ListWebhooks() ([]Webhook, error) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	return append([]Webhook(nil), webhooks...), nil
+}
+
+func GetWebhook(id string) (*Webhook, error) {
+	webhooks, err := ListWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		if webhooks[i].ID == id {
+			return &webhooks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("webhook %s not found", id)
+}
+
+func SaveWebhook(webhook *Webhook) error {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	cached, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	webhooks := append([]Webhook(nil), cached...)
+
+	webhook.HasSecret = webhook.Secret != ""
+	if webhook.ID == "" {
+		webhook.ID = NewID()
+		webhook.CreatedAt = time.Now()
+		webhooks = append(webhooks, *webhook)
+	} else {
+		found := false
+		for i := range webhooks {
+			if webhooks[i].ID == webhook.ID {
+				webhook.CreatedAt = webhooks[i].CreatedAt
+				webhooks[i] = *webhook
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("webhook %s not found", webhook.ID)
+		}
+	}
+
+	return storeWebhooks(webhooks)
+}
+
+func DeleteWebhook(id string) error {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	cached, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for i := range cached {
+		if cached[i].ID == id {
+			webhooks := append(append([]Webhook(nil), cached[:i]...), cached[i+1:]...)
+			return storeWebhooks(webhooks)
+		}
+	}
+	return fmt.Errorf("webhook %s not found", id)
+}
+
+func SaveWebhookDelivery(delivery *WebhookDelivery) error {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	path := filepath.Join(webhookDir, webhookDeliveryFileName)
+	var deliveries []WebhookDelivery
+	if err := readJSONFile(path, &deliveries); err != nil {
+		return err
+	}
+
+	if delivery.ID == "" {
+		delivery.ID = NewID()
+	}
+	deliveries = append(deliveries, *delivery)
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+	}
+
+	return writeJSONFile(path, deliveries)
+}
+
+// ListWebhookDeliveries returns the failed deliveries, newest first.
+func ListWebhookDeliveries() ([]WebhookDelivery, error) {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	var deliveries []WebhookDelivery
+	if err := readJSONFile(filepath.Join(webhookDir, webhookDeliveryFileName), &deliveries); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func useTempWebhookStore(t *testing.T) {
+	t.Helper()
+	dir := webhookDir
+	webhookDir = t.TempDir()
+	webhookCache, webhookCacheLoaded = nil, false
+	t.Cleanup(func() {
+		webhookDir = dir
+		webhookCache, webhookCacheLoaded = nil, false
+	})
+}
+
+func TestWebhookSecretIsStoredButNotEncoded(t *testing.T) {
+	useTempWebhookStore(t)
+
+	hook := Webhook{URL: "https://example.com/hook", Secret: "s3cret", Enabled: true}
+	if err := SaveWebhook(&hook); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read back from disk rather than from the cache
+	webhookCache, webhookCacheLoaded = nil, false
+	webhooks, err := ListWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || webhooks[0].Secret != "s3cret" || !webhooks[0].HasSecret {
+		t.Fatalf("webhooks = %+v", webhooks)
+	}
+
+	data, err := json.Marshal(webhooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") {
+		t.Errorf("secret encoded in %s", data)
+	}
+	if !strings.Contains(string(data), `"has_secret":true`) {
+		t.Errorf("has_secret missing from %s", data)
+	}
+}
+
+func TestDeleteWebhookUpdatesCache(t *testing.T) {
+	useTempWebhookStore(t)
+
+	hook := Webhook{URL: "https://example.com/hook"}
+	if err := SaveWebhook(&hook); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteWebhook(hook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if webhooks, _ := ListWebhooks(); len(webhooks) != 0 {
+		t.Errorf("webhooks = %+v after delete", webhooks)
+	}
+	if err := DeleteWebhook(hook.ID); err == nil {
+		t.Error("deleting a missing webhook succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+// Processor encrypts messages as PGP/MIME (RFC 3156) for receivers with a
+// registered public key. With the "prefer" policy other receivers get the
+// message as is, with "require" sending to them fails.
+type Processor struct {
+	Policy string
+	// keys looks up the public key of a receiver, nil when it has none
+	keys func(email string) (*openpgp.Entity, error)
+}
+
+func NewProcessor(policy string) *Processor {
+	return &Processor{Policy: policy, keys: model.GetPGPKey}
+}
+
+func (p *Processor) Process(m *mailer.Message) error {
+	if p.Policy != model.PGPPolicyPrefer && p.Policy != model.PGPPolicyRequire {
+		return nil
+	}
+
+	var recipients []*openpgp.Entity
+	for _, address := range m.To {
+		key, err := p.keys(address)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			if p.Policy == model.PGPPolicyRequire {
+				return fmt.Errorf("no PGP key registered for %s", address)
+			}
+			return nil
+		}
+		recipients = append(recipients, key)
+	}
+
+	raw, err := m.MIME()
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	envelope, entity, err := mailer.SplitMIME(raw)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encrypt(entity, recipients)
+	if err != nil {
+		return err
+	}
+
+	boundary := mailer.Boundary()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\";\r\n boundary=\"%s\"\r\n\r\n", boundary)
+	b.WriteString("This is an OpenPGP/MIME encrypted message (RFC 4880 and 3156)\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pgp-encrypted\r\n")
+	b.WriteString("Content-Description: PGP/MIME version identification\r\n\r\n")
+	b.WriteString("Version: 1\r\n\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n")
+	b.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+	b.WriteString("Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(encrypted, "\n", "\r\n"))
+	fmt.Fprintf(&b, "\r\n--%s--\r\n", boundary)
+
+	m.Raw = mailer.JoinMIME(envelope, []byte(b.String()))
+	return nil
+}
+
+func encrypt(entity []byte, recipients []*openpgp.Entity) (string, error) {
+	var buf bytes.Buffer
+	armored, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	plaintext, err := openpgp.Encrypt(armored, recipients, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if _, err := plaintext.Write(entity); err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if err := plaintext.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return buf.String(), nil
+}
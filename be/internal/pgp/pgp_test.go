@@ -0,0 +1,108 @@
+package pgp
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+// testProcessor uses the given keys instead of the key store.
+func testProcessor(policy string, keys map[string]*openpgp.Entity) *Processor {
+	p := NewProcessor(policy)
+	p.keys = func(email string) (*openpgp.Entity, error) {
+		return keys[email], nil
+	}
+	return p
+}
+
+func testMessage(to ...string) *mailer.Message {
+	return &mailer.Message{
+		From:     "sender@example.com",
+		To:       to,
+		Subject:  "Hello",
+		TextBody: "Xin chào",
+	}
+}
+
+func TestProcessEncryptsForRegisteredKeys(t *testing.T) {
+	key, err := openpgp.NewEntity("Receiver", "", "receiver@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := testMessage("receiver@example.com")
+	if err := testProcessor(model.PGPPolicyRequire, map[string]*openpgp.Entity{"receiver@example.com": key}).Process(m); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != "Hello" {
+		t.Errorf("Subject = %q, the envelope headers should stay readable", msg.Header.Get("Subject"))
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	version, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Header.Get("Content-Type") != "application/pgp-encrypted" {
+		t.Errorf("first part = %q", version.Header.Get("Content-Type"))
+	}
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := armor.Decode(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{key}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(plaintext), "Content-Type: text/plain") || strings.Contains(string(plaintext), "Subject:") {
+		t.Errorf("decrypted entity = %q", plaintext)
+	}
+}
+
+func TestProcessWithoutKey(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{model.PGPPolicyOff, false},
+		{model.PGPPolicyPrefer, false},
+		{model.PGPPolicyRequire, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			m := testMessage("nokey@example.com")
+			err := testProcessor(tt.policy, nil).Process(m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Process() = %v, want error %v", err, tt.wantErr)
+			}
+			if m.Raw != nil {
+				t.Errorf("message without a key was rewritten")
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+// Package sanitize cleans HTML email bodies against an allowlist of what
+// mail clients render, and reports what else in the body is likely to
+// break or look like spam.
+package sanitize
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Report lists what was changed and what should be checked by hand.
+type Report struct {
+	// RemovedElements counts the dropped elements by tag, e.g. "script (2)"
+	RemovedElements   []string `json:"removed_elements,omitempty"`
+	RemovedAttributes []string `json:"removed_attributes,omitempty"`
+	// BrokenTags are unclosed or stray tags, fixed in the saved body
+	BrokenTags    []string `json:"broken_tags,omitempty"`
+	RelativeLinks []string `json:"relative_links,omitempty"`
+	// MissingAlt lists the images without alt text by src
+	MissingAlt []string `json:"missing_alt,omitempty"`
+	// ImageOnly is set when the body is images with (almost) no text,
+	// which spam filters penalise
+	ImageOnly bool `json:"image_only,omitempty"`
+}
+
+// minTextLength is the visible text below which a body with images counts
+// as image-only
+const minTextLength = 20
+
+func (r *Report) HasIssues() bool {
+	return len(r.RemovedElements) > 0 || len(r.RemovedAttributes) > 0 || len(r.BrokenTags) > 0 ||
+		len(r.RelativeLinks) > 0 || len(r.MissingAlt) > 0 || r.ImageOnly
+}
+
+// Elements kept as they are. Anything else is unwrapped, keeping its
+// content, unless it is in droppedElements.
+var allowedElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Head: true, atom.Body: true, atom.Title: true, atom.Meta: true, atom.Style: true,
+	atom.A: true, atom.Abbr: true, atom.Address: true, atom.B: true, atom.Big: true, atom.Blockquote: true,
+	atom.Br: true, atom.Caption: true, atom.Center: true, atom.Code: true, atom.Col: true, atom.Colgroup: true,
+	atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Em: true, atom.Font: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hr: true, atom.I: true, atom.Img: true, atom.Li: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.S: true, atom.Small: true, atom.Span: true, atom.Strike: true, atom.Strong: true, atom.Sub: true,
+	atom.Sup: true, atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Tfoot: true, atom.Th: true,
+	atom.Thead: true, atom.Tr: true, atom.U: true, atom.Ul: true,
+	atom.Article: true, atom.Section: true, atom.Header: true, atom.Footer: true, atom.Main: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Mark: true,
+}
+
+// Elements removed with their content
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Noscript: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Template: true, atom.Svg: true,
+	atom.Math: true, atom.Canvas: true, atom.Video: true, atom.Audio: true, atom.Input: true,
+	atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Link: true, atom.Base: true,
+}
+
+var allowedAttributes = map[string]bool{
+	"style": true, "class": true, "id": true, "dir": true, "lang": true, "title": true, "role": true,
+	"align": true, "valign": true, "width": true, "height": true, "bgcolor": true, "color": true,
+	"border": true, "cellpadding": true, "cellspacing": true, "colspan": true, "rowspan": true,
+	"face": true, "size": true, "nowrap": true, "scope": true, "background": true,
+	"href": true, "name": true, "target": true, "rel": true, "src": true, "alt": true,
+	"charset": true, "content": true, "type": true, "media": true,
+}
+
+var urlAttributes = map[string]bool{"href": true, "src": true, "background": true}
+
+var safeSchemes = []string{"http:", "https:", "mailto:", "tel:", "cid:"}
+
+// Tags that may be left open in valid HTML
+var optionalEndTags = map[atom.Atom]bool{
+	atom.P: true, atom.Li: true, atom.Dt: true, atom.Dd: true, atom.Tr: true, atom.Td: true,
+	atom.Th: true, atom.Tbody: true, atom.Thead: true, atom.Tfoot: true, atom.Option: true,
+	atom.Colgroup: true, atom.Html: true, atom.Head: true, atom.Body: true,
+}
+
+var documentPattern = regexp.MustCompile(`(?i)<(html|body)\b`)
+
+var actionPattern = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+
+// Template actions are replaced by placeholders between these private use
+// characters while the body is parsed
+const (
+	placeholderStart = "\uE000"
+	placeholderEnd   = "\uE001"
+)
+
+// Sanitize returns the body without unsafe elements and attributes, and
+// the lint report. The body is only rewritten when something had to be
+// removed or repaired, so clean markup is kept exactly as written.
+func Sanitize(body string) (string, *Report, error) {
+	protected, restore := protectActions(body)
+	report := &Report{BrokenTags: brokenTags(protected)}
+
+	isDocument := documentPattern.MatchString(body)
+	var nodes []*html.Node
+	if isDocument {
+		doc, err := html.Parse(strings.NewReader(protected))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		nodes = []*html.Node{doc}
+	} else {
+		context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+		fragment, err := html.ParseFragment(strings.NewReader(protected), context)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		nodes = fragment
+	}
+
+	s := &sanitizer{
+		report:            report,
+		restore:           restore,
+		removedElements:   make(map[string]int),
+		removedAttributes: make(map[string]int),
+	}
+	// The fragment's top-level nodes have no parent, so wrap them
+	root := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	s.clean(root)
+	s.lint(root)
+
+	report.RemovedElements = counted(s.removedElements)
+	report.RemovedAttributes = counted(s.removedAttributes)
+	text := restore.Replace(s.text.String())
+	report.ImageOnly = s.images > 0 && utf8.RuneCountInString(strings.Join(strings.Fields(text), " ")) < minTextLength
+
+	if len(report.RemovedElements) == 0 && len(report.RemovedAttributes) == 0 && len(report.BrokenTags) == 0 {
+		return body, report, nil
+	}
+
+	var b strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return "", nil, fmt.Errorf("failed to render HTML: %w", err)
+		}
+	}
+	return restore.Replace(b.String()), report, nil
+}
+
+// protectActions replaces the template actions of the body with
+// placeholders, and returns the replacer that puts them back. Rendering
+// the parsed body would otherwise escape the quotes of string literals,
+// as in {{date "dd/mm/yyyy" .Due}}, and break the template.
+func protectActions(body string) (string, *strings.Replacer) {
+	var attributes, actions []string
+	protected := actionPattern.ReplaceAllStringFunc(body, func(action string) string {
+		placeholder := fmt.Sprintf("%s%d%s", placeholderStart, len(actions)/2, placeholderEnd)
+		// An action between attributes is parsed as an attribute without
+		// value, which renders with an empty one
+		attributes = append(attributes, placeholder+`=""`, action)
+		actions = append(actions, placeholder, action)
+		return placeholder
+	})
+	return protected, strings.NewReplacer(append(attributes, actions...)...)
+}
+
+type sanitizer struct {
+	report            *Report
+	restore           *strings.Replacer
+	removedElements   map[string]int
+	removedAttributes map[string]int
+	images            int
+	text              strings.Builder
+}
+
+func (s *sanitizer) clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.CommentNode:
+			// Keep conditional comments for Outlook, including the
+			// <!--<![endif]--> closing a block shown to other clients
+			if data := strings.TrimSpace(c.Data); !strings.HasPrefix(data, "[if") && !strings.HasPrefix(data, "<![endif]") {
+				n.RemoveChild(c)
+			}
+		case html.ElementNode:
+			switch {
+			case droppedElements[c.DataAtom]:
+				s.removedElements[c.Data]++
+				n.RemoveChild(c)
+			case !allowedElements[c.DataAtom]:
+				// Unwrap, keeping the content in place
+				s.removedElements[c.Data]++
+				s.clean(c)
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			default:
+				s.cleanAttributes(c)
+				s.clean(c)
+			}
+		}
+		c = next
+	}
+}
+
+func (s *sanitizer) cleanAttributes(n *html.Node) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		value := s.restore.Replace(a.Val)
+		switch {
+		case strings.HasPrefix(key, placeholderStart):
+			// A template action between the attributes
+			kept = append(kept, a)
+		case !allowedAttributes[key] && !strings.HasPrefix(key, "aria-"):
+			s.removedAttributes[key]++
+		case urlAttributes[key] && !safeURL(value, n.DataAtom == atom.Img):
+			s.removedAttributes[key+"="+scheme(value)]++
+		case n.DataAtom == atom.Meta && key == "content" && strings.Contains(strings.ToLower(a.Val), "url="):
+			s.removedAttributes["meta refresh"]++
+		default:
+			kept = append(kept, a)
+		}
+	}
+	n.Attr = kept
+}
+
+// lint collects what is reported without being changed.
+func (s *sanitizer) lint(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if n.Parent == nil || (n.Parent.DataAtom != atom.Style && n.Parent.DataAtom != atom.Title) {
+			s.text.WriteString(n.Data)
+			s.text.WriteString(" ")
+		}
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.A:
+			if href := s.restore.Replace(attr(n, "href")); href != "" && isRelative(href) {
+				s.report.RelativeLinks = append(s.report.RelativeLinks, href)
+			}
+		case atom.Img:
+			s.images++
+			src := s.restore.Replace(attr(n, "src"))
+			if src != "" && isRelative(src) {
+				s.report.RelativeLinks = append(s.report.RelativeLinks, src)
+			}
+			if !hasAttr(n, "alt") {
+				s.report.MissingAlt = append(s.report.MissingAlt, src)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s.lint(c)
+	}
+}
+
+// brokenTags reports end tags without a start tag and elements left open
+// that must be closed.
+func brokenTags(body string) []string {
+	var broken []string
+	var open []atom.Atom
+	var names []string
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return append(broken, "unreadable markup")
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				if !optionalEndTags[open[i]] {
+					broken = append(broken, fmt.Sprintf("<%s> is not closed", names[i]))
+				}
+			}
+			return broken
+		case html.StartTagToken:
+			token := z.Token()
+			if !isVoid(token.DataAtom) {
+				open = append(open, token.DataAtom)
+				names = append(names, token.Data)
+			}
+		case html.EndTagToken:
+			token := z.Token()
+			i := len(open) - 1
+			for i >= 0 && names[i] != token.Data {
+				i--
+			}
+			if i < 0 {
+				broken = append(broken, fmt.Sprintf("</%s> has no opening tag", token.Data))
+				continue
+			}
+			for j := len(open) - 1; j > i; j-- {
+				if !optionalEndTags[open[j]] {
+					broken = append(broken, fmt.Sprintf("<%s> is not closed", names[j]))
+				}
+			}
+			open, names = open[:i], names[:i]
+		}
+	}
+}
+
+func isVoid(a atom.Atom) bool {
+	switch a {
+	case atom.Area, atom.Base, atom.Br, atom.Col, atom.Embed, atom.Hr, atom.Img, atom.Input,
+		atom.Link, atom.Meta, atom.Source, atom.Track, atom.Wbr:
+		return true
+	}
+	return false
+}
+
+func scheme(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if idx := strings.Index(value, ":"); idx != -1 {
+		return value[:idx+1]
+	}
+	return value
+}
+
+// safeURL allows the schemes mail clients open, data: images and template
+// placeholders filled in when sending.
+func safeURL(value string, image bool) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if isRelative(value) || strings.HasPrefix(value, "{{") {
+		return true
+	}
+	if image && strings.HasPrefix(value, "data:image/") {
+		return true
+	}
+	for _, safe := range safeSchemes {
+		if strings.HasPrefix(value, safe) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRelative reports links without a scheme that a mail client cannot
+// resolve. Fragment links and placeholders are fine.
+func isRelative(value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "#") || strings.HasPrefix(value, "{{") || strings.HasPrefix(value, "//") {
+		return false
+	}
+	colon := strings.Index(value, ":")
+	slash := strings.IndexAny(value, "/?#")
+	return colon == -1 || (slash != -1 && slash < colon)
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func counted(counts map[string]int) []string {
+	var items []string
+	for name, count := range counts {
+		items = append(items, fmt.Sprintf("%s (%d)", name, count))
+	}
+	sort.Strings(items)
+	return items
+}
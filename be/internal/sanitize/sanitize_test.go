@@ -0,0 +1,89 @@
+package sanitize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   string
+		report Report
+	}{
+		{
+			name: "clean body is kept as written",
+			body: `<p class="x">Hello {{.Name}}</p>`,
+			want: `<p class="x">Hello {{.Name}}</p>`,
+		},
+		{
+			name:   "script is dropped",
+			body:   `<p>Hi</p><script>alert(1)</script>`,
+			want:   `<p>Hi</p>`,
+			report: Report{RemovedElements: []string{"script (1)"}},
+		},
+		{
+			name:   "conditional comments are kept",
+			body:   `<!--[if mso]><table><tr><td><![endif]--><!--[if !mso]><!--><p>Web</p><!--<![endif]--><!-- note --><script>x()</script>`,
+			want:   `<!--[if mso]><table><tr><td><![endif]--><!--[if !mso]><!--><p>Web</p><!--<![endif]-->`,
+			report: Report{RemovedElements: []string{"script (1)"}},
+		},
+		{
+			name:   "unknown element is unwrapped",
+			body:   `<p><blink>Hi</blink></p>`,
+			want:   `<p>Hi</p>`,
+			report: Report{RemovedElements: []string{"blink (1)"}},
+		},
+		{
+			name:   "event handler and javascript link are removed",
+			body:   `<a href="javascript:alert(1)" onclick="x()">Hi</a>`,
+			want:   `<a>Hi</a>`,
+			report: Report{RemovedAttributes: []string{"href=javascript: (1)", "onclick (1)"}},
+		},
+		{
+			name:   "unclosed tag is closed",
+			body:   `<div><p>Hi`,
+			want:   `<div><p>Hi</p></div>`,
+			report: Report{BrokenTags: []string{"<div> is not closed"}},
+		},
+		{
+			name:   "string literals in actions survive a rewrite",
+			body:   `<p title="{{.Title}}">Due {{date "dd/mm/yyyy" .Due}}</p><script>x()</script>`,
+			want:   `<p title="{{.Title}}">Due {{date "dd/mm/yyyy" .Due}}</p>`,
+			report: Report{RemovedElements: []string{"script (1)"}},
+		},
+		{
+			name:   "actions in links and between attributes survive a rewrite",
+			body:   `<a href="{{.URL}}" {{if .Bold}}style="font-weight:bold"{{end}} onclick="x()">Go</a>`,
+			want:   `<a href="{{.URL}}" {{if .Bold}}style="font-weight:bold" {{end}}>Go</a>`,
+			report: Report{RemovedAttributes: []string{"onclick (1)"}},
+		},
+		{
+			name:   "relative link and missing alt are reported",
+			body:   `<a href="/about">About us and everything else</a><img src="logo.png">`,
+			want:   `<a href="/about">About us and everything else</a><img src="logo.png">`,
+			report: Report{RelativeLinks: []string{"/about", "logo.png"}, MissingAlt: []string{"logo.png"}},
+		},
+		{
+			name:   "image only",
+			body:   `<img src="https://example.com/a.png" alt="">`,
+			want:   `<img src="https://example.com/a.png" alt="">`,
+			report: Report{ImageOnly: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report, err := Sanitize(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(*report, tt.report) {
+				t.Errorf("report = %+v, want %+v", *report, tt.report)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/config"
+)
+
+// chunkSize is the largest chunk sent per INSTREAM frame
+const chunkSize = 64 << 10
+
+// Result is the verdict of the daemon for one file.
+type Result struct {
+	Infected  bool   `json:"infected"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// ClamdScanner scans data through a clamd daemon using the INSTREAM
+// command. Address is either "unix:/path/to/clamd.sock" or "host:port".
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner(address string, timeout time.Duration) *ClamdScanner {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+	} else if strings.HasPrefix(address, "tcp:") {
+		address = strings.TrimPrefix(address, "tcp:")
+	}
+	return &ClamdScanner{network: network, address: address, timeout: timeout}
+}
+
+// Scan streams the data to clamd and parses its reply.
+func (s *ClamdScanner) Scan(data []byte) (*Result, error) {
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	// The z prefix makes clamd use NUL terminated commands and replies
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+
+	size := make([]byte, 4)
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.BigEndian.PutUint32(size, uint32(end-offset))
+		if _, err := conn.Write(size); err != nil {
+			return nil, fmt.Errorf("failed to stream data to clamd: %w", err)
+		}
+		if _, err := conn.Write(data[offset:end]); err != nil {
+			return nil, fmt.Errorf("failed to stream data to clamd: %w", err)
+		}
+	}
+	// A zero length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, fmt.Errorf("failed to stream data to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// parseReply understands "stream: OK", "stream: <name> FOUND" and
+// "<message> ERROR" replies.
+func parseReply(reply string) (*Result, error) {
+	reply = string(bytes.TrimRight([]byte(reply), "\x00\r\n"))
+	_, status, found := strings.Cut(reply, ": ")
+	if !found {
+		status = reply
+	}
+
+	switch {
+	case status == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	case strings.HasSuffix(status, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(status, " ERROR"))
+	}
+	return nil, fmt.Errorf("clamd: unexpected reply %q", reply)
+}
+
+// NewFromConfig returns the scanner configured by the app, or nil when
+// scanning is disabled.
+func NewFromConfig(cfg *config.AppConfig) *ClamdScanner {
+	if cfg.ClamdAddress == "" {
+		return nil
+	}
+	return NewClamdScanner(cfg.ClamdAddress, cfg.ClamdTimeout)
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubClamd accepts one INSTREAM session, collects the streamed data and
+// answers with reply.
+func stubClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		command, err := r.ReadString(0)
+		if err != nil || command != "zINSTREAM\x00" {
+			t.Errorf("command = %q, %v", command, err)
+			return
+		}
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				t.Errorf("read chunk size: %v", err)
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				t.Errorf("read chunk: %v", err)
+				return
+			}
+		}
+		received <- data.Bytes()
+		conn.Write([]byte(reply))
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestClamdScanner(t *testing.T) {
+	// Larger than one chunk to check the framing
+	data := bytes.Repeat([]byte("x"), chunkSize+100)
+
+	tests := []struct {
+		name      string
+		reply     string
+		infected  bool
+		signature string
+		wantErr   string
+	}{
+		{"clean", "stream: OK\x00", false, "", ""},
+		{"infected", "stream: Eicar-Test-Signature FOUND\x00", true, "Eicar-Test-Signature", ""},
+		{"error", "INSTREAM size limit exceeded. ERROR\x00", false, "", "size limit exceeded"},
+		{"unexpected", "stream: what\x00", false, "", "unexpected reply"},
+	}
+	for _, tt := range tests {
+		address, received := stubClamd(t, tt.reply)
+		scanner := NewClamdScanner("tcp:"+address, time.Second)
+
+		result, err := scanner.Scan(data)
+		if got := <-received; !bytes.Equal(got, data) {
+			t.Errorf("%s: clamd received %d bytes, want %d", tt.name, len(got), len(data))
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Infected != tt.infected || result.Signature != tt.signature {
+			t.Errorf("%s: result = %+v", tt.name, result)
+		}
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if _, err := NewClamdScanner(address, time.Second).Scan([]byte("x")); err == nil {
+		t.Error("Scan succeeded without a daemon")
+	}
+}
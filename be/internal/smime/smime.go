@@ -0,0 +1,144 @@
+package smime
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/smallstep/pkcs7"
+)
+
+func init() {
+	// AES-CBC is what mail clients support for enveloped data
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+}
+
+// Processor signs messages with the sender's identity and encrypts them
+// for receivers with a certificate in the store.
+type Processor struct {
+	Options model.SMIMEOptions
+}
+
+func NewProcessor(options model.SMIMEOptions) *Processor {
+	return &Processor{Options: options}
+}
+
+func (p *Processor) Process(m *mailer.Message) error {
+	if !p.Options.Sign && !p.Options.Encrypt {
+		return nil
+	}
+
+	raw, err := m.MIME()
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	envelope, entity, err := mailer.SplitMIME(raw)
+	if err != nil {
+		return err
+	}
+
+	identity, err := model.GetSMIMEIdentity(m.From)
+	if err != nil {
+		return err
+	}
+
+	if p.Options.Sign {
+		if identity == nil {
+			return fmt.Errorf("no S/MIME identity for %s", m.From)
+		}
+		// The identity may have expired or been saved for another address
+		if err := identity.CheckSender(m.From); err != nil {
+			return fmt.Errorf("cannot sign as %s: %w", m.From, err)
+		}
+		if entity, err = sign(entity, identity); err != nil {
+			return err
+		}
+	}
+
+	if p.Options.Encrypt {
+		recipients, err := recipientCertificates(m.To)
+		if err != nil {
+			return err
+		}
+		// Receivers without a certificate get the message unencrypted
+		if recipients != nil {
+			if identity != nil {
+				// Lets the sender read the copy in their sent folder
+				recipients = append(recipients, identity.Certificate)
+			}
+			if entity, err = encrypt(entity, recipients); err != nil {
+				return err
+			}
+		}
+	}
+
+	m.Raw = mailer.JoinMIME(envelope, entity)
+	return nil
+}
+
+// recipientCertificates returns the certificates of all recipients, or nil
+// unless every one of them has a certificate.
+func recipientCertificates(to []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, address := range to {
+		cert, err := model.GetSMIMECertificate(address)
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			return nil, nil
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// sign wraps the entity in a multipart/signed entity with a detached
+// PKCS#7 signature (RFC 8551).
+func sign(entity []byte, identity *model.SMIMEIdentity) ([]byte, error) {
+	signed, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	signed.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signed.AddSignerChain(identity.Certificate, identity.PrivateKey, identity.Chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	signed.Detach()
+	signature, err := signed.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	boundary := mailer.Boundary()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\";\r\n micalg=sha-256; boundary=\"%s\"\r\n\r\n", boundary)
+	b.WriteString("This is a cryptographically signed message in MIME format.\r\n\r\n")
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	b.Write(entity)
+	fmt.Fprintf(&b, "\r\n--%s\r\n", boundary)
+	b.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	b.WriteString(mailer.Base64Lines(base64.StdEncoding.EncodeToString(signature)))
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return []byte(b.String()), nil
+}
+
+// encrypt replaces the entity with a PKCS#7 enveloped-data entity.
+func encrypt(entity []byte, recipients []*x509.Certificate) ([]byte, error) {
+	encrypted, err := pkcs7.Encrypt(entity, recipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	b.WriteString(mailer.Base64Lines(base64.StdEncoding.EncodeToString(encrypted)))
+	return []byte(b.String()), nil
+}
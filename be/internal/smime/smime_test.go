@@ -0,0 +1,178 @@
+package smime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/smallstep/pkcs7"
+)
+
+func testIdentity(t *testing.T, email string) *model.SMIMEIdentity {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: email},
+		EmailAddresses: []string{email},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.SMIMEIdentity{Certificate: cert, PrivateKey: key}
+}
+
+// entityBody decodes the base64 body of a MIME entity.
+func entityBody(t *testing.T, entity []byte) []byte {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(entity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(msg.Body); err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body.String()), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signature parses the PKCS#7 signature of a multipart/signed entity.
+func signature(t *testing.T, signed []byte) *pkcs7.PKCS7 {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	if _, err := reader.NextRawPart(); err != nil {
+		t.Fatal(err)
+	}
+	part, err := reader.NextRawPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(part); err != nil {
+		t.Fatal(err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body.String()), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7
+}
+
+func TestSignAndEncryptRoundTrip(t *testing.T) {
+	sender := testIdentity(t, "sender@example.com")
+	receiver := testIdentity(t, "receiver@example.com")
+	entity := []byte("Content-Type: text/plain; charset=utf-8\r\n\r\nXin chào\r\n")
+
+	signed, err := sign(entity, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encrypt(signed, []*x509.Certificate{receiver.Certificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enveloped, err := pkcs7.Parse(entityBody(t, encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := enveloped.Decrypt(receiver.Certificate, receiver.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, signed) {
+		t.Fatalf("decrypted entity differs from the signed one")
+	}
+
+	// The first part is the signed entity as is, the second the signature
+	msg, err := mail.ReadMessage(bytes.NewReader(decrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/signed" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+	delimiter := "--" + params["boundary"]
+	parts := strings.Split(string(decrypted), delimiter)
+	if len(parts) < 3 || strings.TrimPrefix(strings.TrimSuffix(parts[1], "\r\n"), "\r\n") != string(entity) {
+		t.Fatalf("signed part differs from the entity: %q", parts)
+	}
+
+	p7 := signature(t, decrypted)
+	p7.Content = entity
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	// Someone else's key cannot decrypt it
+	if _, err := enveloped.Decrypt(sender.Certificate, sender.PrivateKey); err == nil {
+		t.Errorf("decrypted with the key of a certificate that is not a recipient")
+	}
+}
+
+func TestSignatureOfForeignKeyDoesNotVerify(t *testing.T) {
+	// Saving such an identity is refused, see SaveSMIMEIdentity
+	identity := testIdentity(t, "sender@example.com")
+	identity.PrivateKey = testIdentity(t, "sender@example.com").PrivateKey
+	entity := []byte("Content-Type: text/plain\r\n\r\nHi\r\n")
+
+	signed, err := sign(entity, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7 := signature(t, signed)
+	p7.Content = entity
+	if err := p7.Verify(); err == nil {
+		t.Errorf("signature made with a foreign key verifies")
+	}
+}
+
+func TestCheckSender(t *testing.T) {
+	identity := testIdentity(t, "sender@example.com")
+	if err := identity.CheckSender("Sender <SENDER@example.com>"); err != nil {
+		t.Errorf("CheckSender(own address) = %v", err)
+	}
+	if err := identity.CheckSender("other@example.com"); err == nil {
+		t.Errorf("CheckSender(other address) succeeded")
+	}
+}
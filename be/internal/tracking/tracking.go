@@ -0,0 +1,116 @@
+// Package tracking adds open and click tracking to HTML messages. Links
+// point back to the app with a signed token naming the campaign, the A/B
+// variant and the receiver, so nothing has to be stored per message.
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var anchorHrefPattern = regexp.MustCompile(`(?i)(<a\b[^>]*?\bhref\s*=\s*)("([^"]*)"|'([^']*)')`)
+
+// Recipient is what a token identifies.
+type Recipient struct {
+	CampaignID string
+	Variant    string
+	Email      string
+}
+
+type Tracker struct {
+	baseURL string
+	key     []byte
+}
+
+// NewTracker returns a tracker for links under baseURL, the public address
+// of the app. Tracking is off when baseURL is empty. Without a secret a
+// random one is used, and links sent before a restart stop being counted.
+func NewTracker(baseURL, secret string) *Tracker {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("failed to generate tracking key: %v", err))
+		}
+	}
+	return &Tracker{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		key:     key,
+	}
+}
+
+func (t *Tracker) Enabled() bool {
+	return t != nil && t.baseURL != ""
+}
+
+func (t *Tracker) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Token identifies the receiver of one message.
+func (t *Tracker) Token(recipient Recipient) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(
+		recipient.CampaignID + "\n" + recipient.Variant + "\n" + recipient.Email))
+	return payload + "." + t.sign(payload)
+}
+
+// Parse checks the signature of a token and returns what it identifies.
+func (t *Tracker) Parse(token string) (Recipient, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(t.sign(payload))) {
+		return Recipient{}, fmt.Errorf("invalid tracking token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("invalid tracking token")
+	}
+	parts := strings.SplitN(string(data), "\n", 3)
+	if len(parts) != 3 {
+		return Recipient{}, fmt.Errorf("invalid tracking token")
+	}
+	return Recipient{CampaignID: parts[0], Variant: parts[1], Email: parts[2]}, nil
+}
+
+// VerifyClick checks that target is the link the token was issued with,
+// so the click URL cannot be used as an open redirect.
+func (t *Tracker) VerifyClick(token, target, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(t.sign(token, target)))
+}
+
+func (t *Tracker) clickURL(token, target string) string {
+	query := url.Values{"u": {target}, "s": {t.sign(token, target)}}
+	return t.baseURL + "/t/c/" + token + "?" + query.Encode()
+}
+
+func (t *Tracker) openURL(token string) string {
+	return t.baseURL + "/t/o/" + token
+}
+
+// Instrument routes the http(s) links of the HTML body through the click
+// URL and adds the open pixel.
+func (t *Tracker) Instrument(body, token string) string {
+	body = anchorHrefPattern.ReplaceAllStringFunc(body, func(tag string) string {
+		groups := anchorHrefPattern.FindStringSubmatch(tag)
+		target := strings.TrimSpace(html.UnescapeString(groups[3] + groups[4]))
+		lower := strings.ToLower(target)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			return tag
+		}
+		return fmt.Sprintf(`%s"%s"`, groups[1], html.EscapeString(t.clickURL(token, target)))
+	})
+
+	pixel := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display:none">`, html.EscapeString(t.openURL(token)))
+	if idx := strings.LastIndex(strings.ToLower(body), "</body>"); idx != -1 {
+		return body[:idx] + pixel + body[idx:]
+	}
+	return body + "\n" + pixel
+}
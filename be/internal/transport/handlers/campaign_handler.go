@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+type CampaignHandler struct{}
+
+type CampaignResponse struct {
+	Success   bool             `json:"success"`
+	Message   string           `json:"message"`
+	Campaign  *model.Campaign  `json:"campaign,omitempty"`
+	Campaigns []model.Campaign `json:"campaigns,omitempty"`
+}
+
+func NewCampaignHandler() *CampaignHandler {
+	return &CampaignHandler{}
+}
+
+func writeCampaignResponse(w http.ResponseWriter, status int, response CampaignResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *CampaignHandler) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := model.ListCampaigns()
+	if err != nil {
+		writeCampaignResponse(w, http.StatusInternalServerError, CampaignResponse{Message: err.Error()})
+		return
+	}
+
+	writeCampaignResponse(w, http.StatusOK, CampaignResponse{
+		Success:   true,
+		Message:   "Campaigns retrieved successfully",
+		Campaigns: campaigns,
+	})
+}
+
+func (h *CampaignHandler) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, err := model.GetCampaign(chi.URLParam(r, "id"))
+	if err != nil {
+		writeCampaignResponse(w, http.StatusNotFound, CampaignResponse{Message: err.Error()})
+		return
+	}
+
+	writeCampaignResponse(w, http.StatusOK, CampaignResponse{
+		Success:  true,
+		Message:  "Campaign retrieved successfully",
+		Campaign: campaign,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+type ColumnMappingHandler struct{}
+
+type ColumnMappingResponse struct {
+	Success  bool                  `json:"success"`
+	Message  string                `json:"message"`
+	Mapping  *model.ColumnMapping  `json:"mapping,omitempty"`
+	Mappings []model.ColumnMapping `json:"mappings,omitempty"`
+}
+
+func NewColumnMappingHandler() *ColumnMappingHandler {
+	return &ColumnMappingHandler{}
+}
+
+func writeColumnMappingResponse(w http.ResponseWriter, status int, response ColumnMappingResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// decodeColumnMapping reads a mapping from the request. The headers are
+// those of an upload's layout; without columns they are detected from the
+// headers.
+func decodeColumnMapping(r *http.Request) (*model.ColumnMapping, string) {
+	var mapping model.ColumnMapping
+	if err := json.NewDecoder(r.Body).Decode(&mapping); err != nil {
+		return nil, "Invalid JSON format"
+	}
+	if len(mapping.Columns) == 0 {
+		mapping.Columns = model.DetectColumns(mapping.Headers)
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err.Error()
+	}
+	return &mapping, ""
+}
+
+func (h *ColumnMappingHandler) CreateColumnMapping(w http.ResponseWriter, r *http.Request) {
+	mapping, msg := decodeColumnMapping(r)
+	if msg != "" {
+		writeColumnMappingResponse(w, http.StatusBadRequest, ColumnMappingResponse{Message: msg})
+		return
+	}
+
+	mapping.ID = ""
+	if err := model.SaveColumnMapping(mapping); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, model.ErrLayoutMapped) {
+			status = http.StatusConflict
+		}
+		writeColumnMappingResponse(w, status, ColumnMappingResponse{
+			Message: "Failed to save column mapping: " + err.Error(),
+		})
+		return
+	}
+
+	writeColumnMappingResponse(w, http.StatusCreated, ColumnMappingResponse{
+		Success: true,
+		Message: "Column mapping created successfully",
+		Mapping: mapping,
+	})
+}
+
+func (h *ColumnMappingHandler) UpdateColumnMapping(w http.ResponseWriter, r *http.Request) {
+	mapping, msg := decodeColumnMapping(r)
+	if msg != "" {
+		writeColumnMappingResponse(w, http.StatusBadRequest, ColumnMappingResponse{Message: msg})
+		return
+	}
+
+	mapping.ID = chi.URLParam(r, "id")
+	if err := model.SaveColumnMapping(mapping); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, model.ErrLayoutMapped) {
+			status = http.StatusConflict
+		}
+		writeColumnMappingResponse(w, status, ColumnMappingResponse{
+			Message: "Failed to update column mapping: " + err.Error(),
+		})
+		return
+	}
+
+	writeColumnMappingResponse(w, http.StatusOK, ColumnMappingResponse{
+		Success: true,
+		Message: "Column mapping updated successfully",
+		Mapping: mapping,
+	})
+}
+
+func (h *ColumnMappingHandler) ListColumnMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := model.ListColumnMappings()
+	if err != nil {
+		writeColumnMappingResponse(w, http.StatusInternalServerError, ColumnMappingResponse{
+			Message: "Failed to retrieve column mappings: " + err.Error(),
+		})
+		return
+	}
+
+	writeColumnMappingResponse(w, http.StatusOK, ColumnMappingResponse{
+		Success:  true,
+		Message:  "Column mappings retrieved successfully",
+		Mappings: mappings,
+	})
+}
+
+func (h *ColumnMappingHandler) DeleteColumnMapping(w http.ResponseWriter, r *http.Request) {
+	if err := model.DeleteColumnMapping(chi.URLParam(r, "id")); err != nil {
+		writeColumnMappingResponse(w, http.StatusNotFound, ColumnMappingResponse{
+			Message: "Failed to delete column mapping: " + err.Error(),
+		})
+		return
+	}
+
+	writeColumnMappingResponse(w, http.StatusOK, ColumnMappingResponse{
+		Success: true,
+		Message: "Column mapping deleted successfully",
+	})
+}
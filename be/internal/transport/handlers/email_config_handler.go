@@ -2,23 +2,119 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/config"
+	"github.com/lambertse/cquan_go_webapp/internal/css"
+	"github.com/lambertse/cquan_go_webapp/internal/document"
+	"github.com/lambertse/cquan_go_webapp/internal/importer"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/markdown"
+	"github.com/lambertse/cquan_go_webapp/internal/merge"
 	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/lambertse/cquan_go_webapp/internal/sanitize"
+	"github.com/lambertse/cquan_go_webapp/internal/scanner"
 )
 
-type EmailConfigHandler struct{}
+type EmailConfigHandler struct {
+	config   *config.AppConfig
+	scanner  *scanner.ClamdScanner
+	markdown *markdown.Renderer
+}
 
 type EmailConfigResponse struct {
 	Success bool               `json:"success"`
 	Message string             `json:"message"`
 	Config  *model.EmailConfig `json:"config,omitempty"`
+	// Templates is the template library, without attachments
+	Templates []model.EmailConfigSummary `json:"templates,omitempty"`
+	Versions  []model.TemplateVersion    `json:"versions,omitempty"`
+	// EstimatedSize is the encoded size of the message without the
+	// per-receiver attachments and documents
+	EstimatedSize int64 `json:"estimated_size,omitempty"`
+	// Lint reports what was removed from the HTML bodies and what else to
+	// check, by body: "body", "locale vi" or "variant A"
+	Lint map[string]*sanitize.Report `json:"lint,omitempty"`
+	// Warnings lists what an import left out of the template
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func NewEmailConfigHandler(cfg *config.AppConfig) *EmailConfigHandler {
+	return &EmailConfigHandler{
+		config:   cfg,
+		scanner:  scanner.NewFromConfig(cfg),
+		markdown: markdown.NewRenderer(cfg.MailLayoutPath),
+	}
+}
+
+// allAttachments returns the attachments of the template and of its
+// locales.
+func allAttachments(config *model.EmailConfig) []model.Attachment {
+	attachments := append([]model.Attachment(nil), config.Attachments...)
+	for _, locale := range config.LocaleNames() {
+		attachments = append(attachments, config.Locales[locale].Attachments...)
+	}
+	return attachments
+}
+
+// scanAttachments runs every attachment through clamd and returns the
+// names of the infected ones with their signature. An attachment that
+// cannot be decoded cannot be scanned either and fails the scan.
+func (h *EmailConfigHandler) scanAttachments(config *model.EmailConfig) ([]string, error) {
+	if h.scanner == nil {
+		return nil, nil
+	}
+
+	var infected []string
+	for _, attachment := range allAttachments(config) {
+		data, err := attachment.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", attachment.Name, err)
+		}
+		result, err := h.scanner.Scan(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", attachment.Name, err)
+		}
+		if result.Infected {
+			infected = append(infected, fmt.Sprintf("%s (%s)", attachment.Name, result.Signature))
+		}
+	}
+	return infected, nil
 }
 
-func NewEmailConfigHandler() *EmailConfigHandler {
-	return &EmailConfigHandler{}
+// estimateMessageSize encodes the parts of the message shared by every
+// receiver and checks them against the size limit.
+func (h *EmailConfigHandler) estimateMessageSize(config *model.EmailConfig) (int64, error) {
+	m := &mailer.Message{Subject: config.Subject}
+	if err := setBody(m, config, config.Body, h.markdown); err != nil {
+		return 0, err
+	}
+
+	for _, attachment := range config.Attachments {
+		data, err := attachment.Decode()
+		if err != nil {
+			continue
+		}
+		if attachment.Inline {
+			m.AttachInline(attachment.Name, attachment.Type, attachment.ContentID, data)
+		} else {
+			m.Attach(attachment.Name, attachment.Type, data)
+		}
+	}
+
+	return m.FitSize(h.config.MaxMessageSize, config.ZipOversizedAttachments)
 }
 
+// SaveEmailConfig saves the standard template edited through
+// /email-config.
 func (h *EmailConfigHandler) SaveEmailConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -28,14 +124,184 @@ func (h *EmailConfigHandler) SaveEmailConfig(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	config.ID = model.StandardTemplateID
+	if config.Name == "" {
+		config.Name = model.StandardTemplateName
+	}
+	h.saveTemplate(w, &config, requestAuthor(r), http.StatusOK, nil)
+}
+
+// requestAuthor is the user saving a template. /email-config may be called
+// without a token, in which case the author is unknown.
+func requestAuthor(r *http.Request) string {
+	claims, err := GetUserFromRequest(r)
+	if err != nil {
+		return ""
+	}
+	return claims.Username
+}
+
+// saveTemplate validates the template, stores it as a new version and
+// writes the response with the given warnings.
+func (h *EmailConfigHandler) saveTemplate(w http.ResponseWriter, config *model.EmailConfig, author string, status int, warnings []string) {
 	// Validate required fields
 	if config.Subject == "" {
 		http.Error(w, `{"success":false,"message":"Subject is required"}`, http.StatusBadRequest)
 		return
 	}
 
+	lint, err := prepareBodies(config)
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			http.Error(w, `{"success":false,"message":"Unknown timezone"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if config.ABTest != nil {
+		message := ""
+		if err := config.ABTest.Validate(); err != nil {
+			message = err.Error()
+		} else if len(config.Locales) > 0 {
+			message = "A/B tests cannot be combined with locales"
+		}
+		if message != "" {
+			response := EmailConfigResponse{
+				Success: false,
+				Message: message,
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	for _, variant := range config.Variants() {
+		if _, err := merge.Parse(variant.Config); err != nil {
+			message := err.Error()
+			if variant.Label != "" {
+				message = fmt.Sprintf("%s: %s", variant.Label, message)
+			}
+			response := EmailConfigResponse{
+				Success: false,
+				Message: message,
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	if config.ReceiverAttachments != nil {
+		if err := config.ReceiverAttachments.Validate(); err != nil {
+			response := EmailConfigResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	for i := range config.Documents {
+		if err := config.Documents[i].Validate(); err != nil {
+			response := EmailConfigResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	if !model.ValidPGPPolicy(config.PGPPolicy) {
+		http.Error(w, `{"success":false,"message":"PGP policy must be off, prefer or require"}`, http.StatusBadRequest)
+		return
+	}
+	if config.SMIME != nil && (config.SMIME.Sign || config.SMIME.Encrypt) &&
+		(config.PGPPolicy == model.PGPPolicyPrefer || config.PGPPolicy == model.PGPPolicyRequire) {
+		http.Error(w, `{"success":false,"message":"S/MIME and PGP cannot be used together"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The campaign footer overrides the sender's own footer
+	if config.Footer != nil {
+		if err := config.Footer.Validate(); err != nil {
+			response := EmailConfigResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	for _, attachment := range allAttachments(config) {
+		if _, err := attachment.Decode(); err != nil {
+			response := EmailConfigResponse{
+				Success: false,
+				Message: fmt.Sprintf("Attachment %s cannot be decoded: %v", attachment.Name, err),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	// Refuse to store anything that could not be checked
+	infected, err := h.scanAttachments(config)
+	if err != nil {
+		log.Printf("Attachment scan failed: %v", err)
+		response := EmailConfigResponse{
+			Success: false,
+			Message: "Attachment scan failed: " + err.Error(),
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if len(infected) > 0 {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: "Infected attachments rejected: " + strings.Join(infected, ", "),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Report the largest of the locale and A/B variants
+	var size int64
+	for _, variant := range config.Variants() {
+		variantSize, err := h.estimateMessageSize(variant.Config)
+		if err != nil {
+			response := EmailConfigResponse{
+				Success:       false,
+				Message:       "Message is too large: " + err.Error(),
+				EstimatedSize: variantSize,
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		size = max(size, variantSize)
+	}
+
 	// Save config using model function
-	if err := model.SaveEmailConfig(&config); err != nil {
+	if err := model.SaveEmailConfig(config, author); err != nil {
 		response := EmailConfigResponse{
 			Success: false,
 			Message: "Failed to save email configuration: " + err.Error(),
@@ -45,15 +311,82 @@ func (h *EmailConfigHandler) SaveEmailConfig(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	w.WriteHeader(status)
 	response := EmailConfigResponse{
-		Success: true,
-		Message: "Email configuration saved successfully",
-		Config:  &config,
+		Success:       true,
+		Message:       "Email configuration saved successfully",
+		Config:        config,
+		EstimatedSize: size,
+		Lint:          lint,
+		Warnings:      warnings,
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// prepareBodies checks the content type of a template sent by the form and
+// cleans its HTML bodies, as they are stored. It returns the reports that
+// found something.
+func prepareBodies(config *model.EmailConfig) (map[string]*sanitize.Report, error) {
+	switch config.ContentType {
+	case "":
+		// New saves from the form are editor HTML; only templates stored
+		// before the content type was added default to plain text
+		config.ContentType = model.ContentTypeHTML
+	case model.ContentTypeText, model.ContentTypeHTML, model.ContentTypeMarkdown:
+	default:
+		return nil, fmt.Errorf("Content type must be text/plain, text/html or text/markdown")
+	}
+	return sanitizeBodies(config)
+}
+
+// sanitizeBodies cleans the HTML bodies of the template in place and
+// returns the reports that found something.
+func sanitizeBodies(config *model.EmailConfig) (map[string]*sanitize.Report, error) {
+	if !config.IsHTML() {
+		return nil, nil
+	}
+
+	lint := make(map[string]*sanitize.Report)
+	clean := func(label string, body *string) error {
+		if *body == "" {
+			return nil
+		}
+		sanitized, report, err := sanitize.Sanitize(*body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		*body = sanitized
+		if report.HasIssues() {
+			lint[label] = report
+		}
+		return nil
+	}
+
+	if err := clean("body", &config.Body); err != nil {
+		return nil, err
+	}
+	for name, content := range config.Locales {
+		if err := clean("locale "+name, &content.Body); err != nil {
+			return nil, err
+		}
+		config.Locales[name] = content
+	}
+	if config.ABTest != nil {
+		for i := range config.ABTest.Variants {
+			variant := &config.ABTest.Variants[i]
+			if err := clean("variant "+variant.Name, &variant.Body); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(lint) == 0 {
+		return nil, nil
+	}
+	return lint, nil
+}
+
 func (h *EmailConfigHandler) GetEmailConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -77,3 +410,512 @@ func (h *EmailConfigHandler) GetEmailConfig(w http.ResponseWriter, r *http.Reque
 
 	json.NewEncoder(w).Encode(response)
 }
+
+func (h *EmailConfigHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	templates, err := model.ListEmailConfigs()
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: "Failed to list templates: " + err.Error(),
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success:   true,
+		Message:   "Templates retrieved successfully",
+		Templates: templates,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *EmailConfigHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var config model.EmailConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid JSON format"}`, http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(config.Name) == "" {
+		http.Error(w, `{"success":false,"message":"Name is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	config.ID = ""
+	config.CreatedAt = time.Time{}
+	h.saveTemplate(w, &config, requestAuthor(r), http.StatusCreated, nil)
+}
+
+// ImportTemplate creates a template from an uploaded .eml or .html file.
+// The name defaults to the file name, the subject to the name.
+func (h *EmailConfigHandler) ImportTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, `{"success":false,"message":"Unable to parse form"}`, http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, `{"success":false,"message":"File is required"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, `{"success":false,"message":"Unable to read file"}`, http.StatusBadRequest)
+		return
+	}
+
+	config, warnings, err := importer.Import(header.Filename, data)
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: "Failed to import template: " + err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	config.Name = strings.TrimSpace(r.FormValue("name"))
+	if config.Name == "" {
+		config.Name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	if config.Subject == "" {
+		config.Subject = config.Name
+	}
+	h.saveTemplate(w, config, requestAuthor(r), http.StatusCreated, warnings)
+}
+
+func (h *EmailConfigHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	config, err := model.GetEmailConfig(chi.URLParam(r, "id"))
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success: true,
+		Message: "Template retrieved successfully",
+		Config:  config,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *EmailConfigHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	existing, err := model.GetEmailConfig(chi.URLParam(r, "id"))
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	var config model.EmailConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid JSON format"}`, http.StatusBadRequest)
+		return
+	}
+	config.ID = existing.ID
+	if strings.TrimSpace(config.Name) == "" {
+		config.Name = existing.Name
+	}
+	h.saveTemplate(w, &config, requestAuthor(r), http.StatusOK, nil)
+}
+
+func (h *EmailConfigHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := model.DeleteEmailConfig(chi.URLParam(r, "id")); err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success: true,
+		Message: "Template deleted successfully",
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *EmailConfigHandler) ListTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	versions, err := model.ListTemplateVersions(chi.URLParam(r, "id"))
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success:  true,
+		Message:  "Template versions retrieved successfully",
+		Versions: versions,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *EmailConfigHandler) GetTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid version"}`, http.StatusBadRequest)
+		return
+	}
+	config, err := model.GetTemplateVersion(chi.URLParam(r, "id"), version)
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success: true,
+		Message: "Template version retrieved successfully",
+		Config:  config,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RestoreTemplateVersion makes an old version current again by saving it
+// as a new version, so the history is kept.
+func (h *EmailConfigHandler) RestoreTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid version"}`, http.StatusBadRequest)
+		return
+	}
+	config, err := model.RestoreTemplateVersion(chi.URLParam(r, "id"), version, requestAuthor(r))
+	if err != nil {
+		response := EmailConfigResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := EmailConfigResponse{
+		Success: true,
+		Message: fmt.Sprintf("Version %d restored as version %d", version, config.Version),
+		Config:  config,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type TemplateDiffResponse struct {
+	Success bool                   `json:"success"`
+	Message string                 `json:"message"`
+	From    int                    `json:"from"`
+	To      int                    `json:"to"`
+	Changes []model.TemplateChange `json:"changes"`
+}
+
+// DiffTemplateVersions compares the versions given by the from and to
+// query parameters. To defaults to the current version.
+func (h *EmailConfigHandler) DiffTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := chi.URLParam(r, "id")
+	current, err := model.GetEmailConfig(id)
+	if err != nil {
+		response := TemplateDiffResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid from version"}`, http.StatusBadRequest)
+		return
+	}
+	to := current.Version
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil {
+			http.Error(w, `{"success":false,"message":"Invalid to version"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var configs [2]*model.EmailConfig
+	for i, version := range []int{from, to} {
+		if configs[i], err = model.GetTemplateVersion(id, version); err != nil {
+			response := TemplateDiffResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	changes, err := model.DiffTemplates(configs[0], configs[1])
+	if err != nil {
+		response := TemplateDiffResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := TemplateDiffResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d fields changed", len(changes)),
+		From:    from,
+		To:      to,
+		Changes: changes,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadTemplate returns the requested template, or the standard one when
+// the request names none.
+func loadTemplate(id string) (*model.EmailConfig, error) {
+	if id == "" {
+		return model.GetLatestEmailConfig()
+	}
+	return model.GetEmailConfig(id)
+}
+
+type TemplateValidationResponse struct {
+	Success        bool                  `json:"success"`
+	Message        string                `json:"message"`
+	Variables      []merge.Variable      `json:"variables"`
+	MissingColumns []string              `json:"missing_columns"`
+	Errors         []model.ReceiverError `json:"errors"`
+	// Locales maps the receiver ID (its row) to the locale it would get
+	Locales map[string]string `json:"locales,omitempty"`
+	// Skipped counts the receivers left out by the filters
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// ValidateEmailConfig checks the variables used by a saved template
+// against an uploaded receiver list before anything is sent.
+func (h *EmailConfigHandler) ValidateEmailConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var mailReq MailRequest
+	if err := json.NewDecoder(r.Body).Decode(&mailReq); err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid JSON format"}`, http.StatusBadRequest)
+		return
+	}
+
+	config, err := loadTemplate(mailReq.TemplateID)
+	if err != nil {
+		response := TemplateValidationResponse{
+			Success: false,
+			Message: "Failed to retrieve email configuration: " + err.Error(),
+		}
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	total := len(mailReq.Data)
+	if mailReq.Data, err = model.FilterReceivers(mailReq.Data, mailReq.Filters); err != nil {
+		response := TemplateValidationResponse{
+			Success: false,
+			Message: "Invalid filter: " + err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	variables, err := merge.Variables(config)
+	if err != nil {
+		response := TemplateValidationResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	missing, errors := merge.Check(variables, mailReq.Data)
+	// With a column missing every document fails, which is reported above
+	if len(missing) == 0 {
+		for i := range mailReq.Data {
+			receiver := &mailReq.Data[i]
+			for j := range config.Documents {
+				if err := document.Check(&config.Documents[j], receiver, config.Location()); err != nil {
+					errors = append(errors, model.NewReceiverError(receiver, err.Error()))
+				}
+			}
+		}
+	}
+	locales := make(map[string]string, len(mailReq.Data))
+	for i := range mailReq.Data {
+		_, locale := config.ForReceiver(&mailReq.Data[i])
+		locales[mailReq.Data[i].ID] = locale
+	}
+
+	response := TemplateValidationResponse{
+		Success:        len(missing) == 0 && len(errors) == 0,
+		Message:        "Template is valid for all receivers",
+		Variables:      variables,
+		MissingColumns: missing,
+		Errors:         errors,
+		Locales:        locales,
+		Skipped:        total - len(mailReq.Data),
+	}
+	if !response.Success {
+		response.Message = fmt.Sprintf("%d variables are missing from the sheet, %d errors in receiver values or documents", len(missing), len(errors))
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type PreviewRequest struct {
+	// Config previews an unsaved template, TemplateID a saved one
+	TemplateID string             `json:"template_id,omitempty"`
+	Config     *model.EmailConfig `json:"config,omitempty"`
+	// Receiver fills in the template variables, which are shown as written
+	// when it is missing
+	Receiver *model.Receiver `json:"receiver,omitempty"`
+}
+
+type PreviewResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html,omitempty"`
+	Text    string `json:"text"`
+	// Warnings lists the CSS that could not be inlined or that mail
+	// clients ignore
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PreviewEmailConfig renders the body as it is sent, with the CSS of its
+// <style> blocks inlined.
+func (h *EmailConfigHandler) PreviewEmailConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"success":false,"message":"Invalid JSON format"}`, http.StatusBadRequest)
+		return
+	}
+
+	config := req.Config
+	if config == nil {
+		var err error
+		if config, err = loadTemplate(req.TemplateID); err != nil {
+			response := PreviewResponse{
+				Success: false,
+				Message: "Failed to retrieve email configuration: " + err.Error(),
+			}
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	} else if _, err := prepareBodies(config); err != nil {
+		// An unsaved template is previewed as it would be stored
+		response := PreviewResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	subject, body := config.Subject, config.Body
+	if req.Receiver != nil {
+		config, _ = config.ForReceiver(req.Receiver)
+		config, _ = config.ForABTest(req.Receiver)
+		tmpl, err := merge.Parse(config)
+		if err == nil {
+			subject, body, err = tmpl.Execute(req.Receiver)
+		}
+		if err != nil {
+			response := PreviewResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	response := PreviewResponse{
+		Success: true,
+		Message: "Preview rendered successfully",
+		Subject: subject,
+		Text:    body,
+	}
+	if config.IsHTML() || config.IsMarkdown() {
+		htmlBody := body
+		if config.IsMarkdown() {
+			var err error
+			if htmlBody, _, err = h.markdown.Render(subject, body); err != nil {
+				response := PreviewResponse{
+					Success: false,
+					Message: err.Error(),
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+		}
+		inlined, err := css.Inline(htmlBody)
+		if err != nil {
+			response := PreviewResponse{
+				Success: false,
+				Message: err.Error(),
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		response.HTML = inlined.HTML
+		response.Text = mailer.HTMLToText(inlined.HTML)
+		response.Warnings = inlined.Warnings
+	}
+	json.NewEncoder(w).Encode(response)
+}
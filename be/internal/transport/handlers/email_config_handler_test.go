@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lambertse/cquan_go_webapp/internal/markdown"
+)
+
+func TestPreviewUnsavedConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		status   int
+		html     string
+		text     string
+		excluded string
+	}{
+		{
+			name:     "empty content type is HTML",
+			request:  `{"config":{"subject":"Hi","body":"<p>Hello</p><script>alert(1)</script>"}}`,
+			status:   http.StatusOK,
+			html:     "<p>Hello</p>",
+			text:     "Hello",
+			excluded: "script",
+		},
+		{
+			name:     "merged with the receiver",
+			request:  `{"config":{"subject":"Hi {{.Name}}","body":"<p onclick=\"x()\">Hello {{.Name}}</p>"},"receiver":{"name":"Tom"}}`,
+			status:   http.StatusOK,
+			html:     "<p>Hello Tom</p>",
+			text:     "Hello Tom",
+			excluded: "onclick",
+		},
+		{
+			name:    "plain text is kept",
+			request: `{"config":{"subject":"Hi","content_type":"text/plain","body":"<script>"}}`,
+			status:  http.StatusOK,
+			text:    "<script>",
+		},
+		{
+			name:    "unknown content type",
+			request: `{"config":{"subject":"Hi","content_type":"image/png","body":"Hello"}}`,
+			status:  http.StatusBadRequest,
+		},
+	}
+
+	h := &EmailConfigHandler{markdown: markdown.NewRenderer("")}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.PreviewEmailConfig(rec, httptest.NewRequest(http.MethodPost, "/email-config/preview", strings.NewReader(tt.request)))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response PreviewResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(response.HTML, tt.html) {
+				t.Errorf("HTML = %q, want it to contain %q", response.HTML, tt.html)
+			}
+			if tt.html == "" && response.HTML != "" {
+				t.Errorf("HTML = %q, want none", response.HTML)
+			}
+			if tt.excluded != "" && strings.Contains(response.HTML, tt.excluded) {
+				t.Errorf("HTML = %q, want no %q", response.HTML, tt.excluded)
+			}
+			if strings.TrimSpace(response.Text) != tt.text {
+				t.Errorf("text = %q, want %q", response.Text, tt.text)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -9,29 +10,59 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/config"
 	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/lambertse/cquan_go_webapp/internal/scanner"
 )
 
 type FileHandler struct {
+	scanner      *scanner.ClamdScanner
+	defaultSheet string
 }
 
-func NewFileHandler() *FileHandler {
-	handler := FileHandler{}
+func NewFileHandler(cfg *config.AppConfig) *FileHandler {
+	handler := FileHandler{
+		scanner:      scanner.NewFromConfig(cfg),
+		defaultSheet: cfg.ReceiverSheet,
+	}
 	return &handler
 }
 
+type UploadResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	// Sheets lists every sheet of the workbook, Selected the ones read
+	Sheets   []string `json:"sheets,omitempty"`
+	Selected []string `json:"selected,omitempty"`
+	// Layouts tells how the columns of each sheet were read, for saving
+	// a column mapping
+	Layouts   []model.SheetLayout `json:"layouts,omitempty"`
+	Receivers []*model.Receiver   `json:"receivers"`
+}
+
+func writeUploadResponse(w http.ResponseWriter, status int, response UploadResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SaveFile reads the receivers of an uploaded workbook. The "sheet" form
+// field, which may be repeated, picks the sheets to read, and "mapping"
+// the ID of a saved column mapping to apply.
 func (h *FileHandler) SaveFile(w http.ResponseWriter, r *http.Request) {
 	// Parse multipart form (32MB max)
 	var err error
 	if err = r.ParseMultipartForm(32 << 20); err != nil {
 		log.Printf("Error parsing multipart form: %v", err)
-		http.Error(w, "Bad Request: Unable to parse form", http.StatusBadRequest)
+		writeUploadResponse(w, http.StatusBadRequest, UploadResponse{Message: "Unable to parse form"})
 		return
 	}
 	file, _, err := r.FormFile("file")
 	if err != nil {
 		log.Printf("Error retrieving file from form: %v", err)
-		http.Error(w, "Bad Request: Unable to retrieve file", http.StatusBadRequest)
+		writeUploadResponse(w, http.StatusBadRequest, UploadResponse{Message: "Unable to retrieve file"})
+		return
 	}
 	defer file.Close()
 
@@ -39,27 +70,50 @@ func (h *FileHandler) SaveFile(w http.ResponseWriter, r *http.Request) {
 	log.Printf("File name: %s", fileName)
 	if err != nil {
 		log.Printf("Error storing file: %v", err)
-		http.Error(w, "Internal Server Error: Unable to store file", http.StatusInternalServerError)
+		writeUploadResponse(w, http.StatusInternalServerError, UploadResponse{Message: "Unable to store file"})
 		return
 	}
 
-	receivers, err := model.GetReceiverFromSource(fileName)
-	// Docode receiver into JSON and send it back
+	sheets, err := model.ListSheets(fileName)
 	if err != nil {
-		log.Printf("Error getting receivers from source: %v", err)
-		http.Error(w, "Internal Server Error: Unable to process file", http.StatusInternalServerError)
+		log.Printf("Error opening workbook: %v", err)
+		writeUploadResponse(w, http.StatusBadRequest, UploadResponse{Message: "Unable to open workbook"})
 		return
 	}
-	jsonResponse := model.EncodeReceiversToJSON(receivers)
-	// Set the response header to application/json
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(jsonResponse))
+	selected, err := model.SelectSheets(sheets, r.MultipartForm.Value["sheet"], h.defaultSheet)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
-		http.Error(w, "Internal Server Error: Unable to write response", http.StatusInternalServerError)
+		writeUploadResponse(w, http.StatusBadRequest, UploadResponse{Message: err.Error(), Sheets: sheets})
 		return
 	}
+
+	var mapping *model.ColumnMapping
+	if id := r.FormValue("mapping"); id != "" {
+		if mapping, err = model.GetColumnMapping(id); err != nil {
+			writeUploadResponse(w, http.StatusBadRequest, UploadResponse{Message: err.Error(), Sheets: sheets})
+			return
+		}
+	}
+
+	receivers, layouts, err := model.GetReceiverFromSource(fileName, selected, mapping)
+	if err != nil {
+		log.Printf("Error getting receivers from source: %v", err)
+		writeUploadResponse(w, http.StatusUnprocessableEntity, UploadResponse{
+			Message:  "Unable to process file: " + err.Error(),
+			Sheets:   sheets,
+			Selected: selected,
+			Layouts:  layouts,
+		})
+		return
+	}
+
+	writeUploadResponse(w, http.StatusOK, UploadResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Read %d receivers", len(receivers)),
+		Sheets:    sheets,
+		Selected:  selected,
+		Layouts:   layouts,
+		Receivers: receivers,
+	})
 }
 
 func storeFile(file multipart.File) (string, error) {
@@ -77,3 +131,82 @@ func storeFile(file multipart.File) (string, error) {
 	}
 	return filePath, nil
 }
+
+type ReceiverArchiveResponse struct {
+	Success   bool     `json:"success"`
+	Message   string   `json:"message"`
+	ArchiveID string   `json:"archive_id,omitempty"`
+	Files     []string `json:"files,omitempty"`
+}
+
+func writeReceiverArchiveResponse(w http.ResponseWriter, status int, response ReceiverArchiveResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SaveReceiverArchive stores a zip of per-receiver attachments. The returned
+// archive ID goes into the receiver_attachments option of the email config.
+func (h *FileHandler) SaveReceiverArchive(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		log.Printf("Error parsing multipart form: %v", err)
+		writeReceiverArchiveResponse(w, http.StatusBadRequest, ReceiverArchiveResponse{Message: "Unable to parse form"})
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error retrieving file from form: %v", err)
+		writeReceiverArchiveResponse(w, http.StatusBadRequest, ReceiverArchiveResponse{Message: "Unable to retrieve file"})
+		return
+	}
+	defer file.Close()
+
+	// clamd looks inside the archive itself
+	if h.scanner != nil {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			writeReceiverArchiveResponse(w, http.StatusBadRequest, ReceiverArchiveResponse{Message: "Unable to read file"})
+			return
+		}
+		result, err := h.scanner.Scan(data)
+		if err != nil {
+			log.Printf("Archive scan failed: %v", err)
+			writeReceiverArchiveResponse(w, http.StatusServiceUnavailable, ReceiverArchiveResponse{Message: "Archive scan failed: " + err.Error()})
+			return
+		}
+		if result.Infected {
+			writeReceiverArchiveResponse(w, http.StatusBadRequest, ReceiverArchiveResponse{Message: "Infected archive rejected: " + result.Signature})
+			return
+		}
+	}
+
+	id, files, err := model.SaveReceiverArchive(file, header.Size)
+	if err != nil {
+		log.Printf("Error extracting receiver archive: %v", err)
+		writeReceiverArchiveResponse(w, http.StatusBadRequest, ReceiverArchiveResponse{Message: err.Error()})
+		return
+	}
+
+	writeReceiverArchiveResponse(w, http.StatusOK, ReceiverArchiveResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("Extracted %d files", len(files)),
+		ArchiveID: id,
+		Files:     files,
+	})
+}
+
+func (h *FileHandler) GetReceiverArchive(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	files, err := model.ListReceiverArchive(id)
+	if err != nil {
+		writeReceiverArchiveResponse(w, http.StatusNotFound, ReceiverArchiveResponse{Message: err.Error()})
+		return
+	}
+
+	writeReceiverArchiveResponse(w, http.StatusOK, ReceiverArchiveResponse{
+		Success:   true,
+		Message:   "Archive retrieved successfully",
+		ArchiveID: id,
+		Files:     files,
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+type FooterHandler struct{}
+
+type FooterResponse struct {
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Footer  *model.Footer  `json:"footer,omitempty"`
+	Preview *FooterPreview `json:"preview,omitempty"`
+}
+
+type FooterPreview struct {
+	HTML string `json:"html"`
+	Text string `json:"text"`
+}
+
+func NewFooterHandler() *FooterHandler {
+	return &FooterHandler{}
+}
+
+func writeFooterResponse(w http.ResponseWriter, status int, response FooterResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *FooterHandler) GetFooter(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	footer, err := model.GetUserFooter(userClaims.Username)
+	if err != nil {
+		writeFooterResponse(w, http.StatusInternalServerError, FooterResponse{
+			Message: "Failed to retrieve footer: " + err.Error(),
+		})
+		return
+	}
+	if footer == nil {
+		writeFooterResponse(w, http.StatusNotFound, FooterResponse{Message: "No footer configured"})
+		return
+	}
+
+	response := FooterResponse{
+		Success: true,
+		Message: "Footer retrieved successfully",
+		Footer:  footer,
+	}
+	if html, text, err := footer.Render(footer.Data(userClaims.Username, time.Now())); err == nil {
+		response.Preview = &FooterPreview{HTML: html, Text: text}
+	}
+	writeFooterResponse(w, http.StatusOK, response)
+}
+
+func (h *FooterHandler) SaveFooter(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var footer model.Footer
+	if err := json.NewDecoder(r.Body).Decode(&footer); err != nil {
+		writeFooterResponse(w, http.StatusBadRequest, FooterResponse{Message: "Invalid JSON format"})
+		return
+	}
+	if err := footer.Validate(); err != nil {
+		writeFooterResponse(w, http.StatusBadRequest, FooterResponse{Message: err.Error()})
+		return
+	}
+
+	if err := model.SaveUserFooter(userClaims.Username, &footer); err != nil {
+		writeFooterResponse(w, http.StatusInternalServerError, FooterResponse{
+			Message: "Failed to save footer: " + err.Error(),
+		})
+		return
+	}
+
+	writeFooterResponse(w, http.StatusOK, FooterResponse{
+		Success: true,
+		Message: "Footer saved successfully",
+		Footer:  &footer,
+	})
+}
+
+func (h *FooterHandler) DeleteFooter(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := model.DeleteUserFooter(userClaims.Username); err != nil {
+		writeFooterResponse(w, http.StatusInternalServerError, FooterResponse{
+			Message: "Failed to delete footer: " + err.Error(),
+		})
+		return
+	}
+
+	writeFooterResponse(w, http.StatusOK, FooterResponse{
+		Success: true,
+		Message: "Footer deleted successfully",
+	})
+}
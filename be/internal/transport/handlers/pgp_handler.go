@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+type PGPHandler struct{}
+
+type PGPResponse struct {
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Keys    []model.PGPKey `json:"keys,omitempty"`
+}
+
+func NewPGPHandler() *PGPHandler {
+	return &PGPHandler{}
+}
+
+func writePGPResponse(w http.ResponseWriter, status int, response PGPResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SaveKeys registers the armored public keys of an uploaded file under
+// the email addresses of their user IDs.
+func (h *PGPHandler) SaveKeys(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Error parsing multipart form: %v", err)
+		writePGPResponse(w, http.StatusBadRequest, PGPResponse{Message: "Unable to parse form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error retrieving file from form: %v", err)
+		writePGPResponse(w, http.StatusBadRequest, PGPResponse{Message: "Unable to retrieve file"})
+		return
+	}
+	defer file.Close()
+
+	armored, err := io.ReadAll(file)
+	if err != nil {
+		writePGPResponse(w, http.StatusBadRequest, PGPResponse{Message: "Unable to read file"})
+		return
+	}
+
+	keys, err := model.SavePGPKeys(armored)
+	if err != nil {
+		writePGPResponse(w, http.StatusBadRequest, PGPResponse{Message: err.Error(), Keys: keys})
+		return
+	}
+
+	writePGPResponse(w, http.StatusOK, PGPResponse{
+		Success: true,
+		Message: "PGP keys saved successfully",
+		Keys:    keys,
+	})
+}
+
+func (h *PGPHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := model.ListPGPKeys()
+	if err != nil {
+		writePGPResponse(w, http.StatusInternalServerError, PGPResponse{Message: err.Error()})
+		return
+	}
+
+	writePGPResponse(w, http.StatusOK, PGPResponse{
+		Success: true,
+		Message: "PGP keys retrieved successfully",
+		Keys:    keys,
+	})
+}
+
+func (h *PGPHandler) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := model.DeletePGPKey(chi.URLParam(r, "email")); err != nil {
+		writePGPResponse(w, http.StatusNotFound, PGPResponse{Message: err.Error()})
+		return
+	}
+
+	writePGPResponse(w, http.StatusOK, PGPResponse{
+		Success: true,
+		Message: "PGP key deleted successfully",
+	})
+}
@@ -3,35 +3,96 @@ package handlers
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/config"
+	"github.com/lambertse/cquan_go_webapp/internal/css"
+	"github.com/lambertse/cquan_go_webapp/internal/document"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/markdown"
+	"github.com/lambertse/cquan_go_webapp/internal/merge"
 	"github.com/lambertse/cquan_go_webapp/internal/model"
-	"gopkg.in/mail.v2"
+	"github.com/lambertse/cquan_go_webapp/internal/pgp"
+	"github.com/lambertse/cquan_go_webapp/internal/smime"
+	"github.com/lambertse/cquan_go_webapp/internal/tracking"
+	"github.com/lambertse/cquan_go_webapp/internal/webhook"
 )
 
 const sendMailRetryCount = 4
 
+// maxPreparedSize caps the total size of the messages built by the
+// precheck that are kept for sending, larger jobs build the rest again
+const maxPreparedSize = 256 << 20
+
 type SendMailHandler struct {
+	config    *config.AppConfig
+	webhooks  *webhook.Dispatcher
+	documents *document.Renderer
+	markdown  *markdown.Renderer
+	tracker   *tracking.Tracker
+	// transport is shared by every send job so the failover state lasts
+	// beyond a single request
+	transport    mailer.Transport
+	transportErr error
+	// saveCampaign records the results of a job
+	saveCampaign func(campaign *model.Campaign) error
 }
 
-func NewSendMailHandler() *SendMailHandler {
-	handler := SendMailHandler{}
+func NewSendMailHandler(cfg *config.AppConfig, webhooks *webhook.Dispatcher, tracker *tracking.Tracker) *SendMailHandler {
+	handler := SendMailHandler{
+		config:       cfg,
+		webhooks:     webhooks,
+		tracker:      tracker,
+		documents:    document.NewRenderer(cfg.PDFFontPath),
+		markdown:     markdown.NewRenderer(cfg.MailLayoutPath),
+		saveCampaign: model.SaveCampaign,
+	}
+	handler.transport, handler.transportErr = mailer.NewTransportFromConfig(cfg)
+	if handler.transportErr != nil {
+		log.Printf("Error creating mail transport: %v", handler.transportErr)
+	}
 	return &handler
 }
 
 type MailRequest struct {
-	Data []model.Receiver `json:"data"`
+	// TemplateID picks a template from the library, the standard template
+	// is used when empty
+	TemplateID string           `json:"template_id,omitempty"`
+	Data       []model.Receiver `json:"data"`
+	// Filters limit the job to the receivers passing all of them
+	Filters []model.ReceiverFilter `json:"filters,omitempty"`
 }
 
 type MailResponse struct {
-	Success []model.Receiver `json:"success"`
-	Failed  []model.Receiver `json:"failed"`
+	JobID           string           `json:"job_id"`
+	TemplateID      string           `json:"template_id"`
+	TemplateVersion int              `json:"template_version"`
+	Success         []model.Receiver `json:"success"`
+	Failed          []model.Receiver `json:"failed"`
+	// Locales maps the receiver ID (its row) to the locale it was sent in
+	Locales map[string]string `json:"locales,omitempty"`
+	// Variants maps the receiver ID to its A/B variant
+	Variants map[string]string `json:"variants,omitempty"`
+	// Held counts the receivers waiting for the winner of the A/B test
+	Held int `json:"held,omitempty"`
+	// Skipped counts the receivers left out by the filters
+	Skipped int `json:"skipped,omitempty"`
+}
+
+type SendPrecheckResponse struct {
+	Success bool                  `json:"success"`
+	Message string                `json:"message"`
+	Errors  []model.ReceiverError `json:"errors"`
 }
 
 func (h *SendMailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
@@ -45,7 +106,7 @@ func (h *SendMailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 	from := userClaims.Username
 	mailToken := userClaims.MailToken
 	if from == "" || mailToken == "" {
-		fmt.Errorf("missing environment variables GMAIL_ADDRESS or MAIL_TOKEN")
+		log.Printf("Missing sender address or mail token in token claims")
 		http.Error(w, "Internal Server Error: Missing email configuration", http.StatusInternalServerError)
 		return
 	}
@@ -57,45 +118,218 @@ func (h *SendMailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialize response lists
-	var successReceivers []model.Receiver
-	var failedReceivers []model.Receiver
+	// Load the saved email configuration
+	config, err := loadTemplate(mailReq.TemplateID)
+	if err != nil {
+		log.Printf("Error loading email configuration: %v", err)
+		http.Error(w, "Email configuration not found", http.StatusBadRequest)
+		return
+	}
 
-	for _, receiver := range mailReq.Data {
-		err := sendEmail(from, mailToken, &receiver)
-		if err != nil {
-		           fmt.Println("Error: ", err.Error())
-		          if strings.Contains(err.Error(), "Username and Password not accepted") {
-		               log.Printf("Authentication error: %v", err)
-		               http.Error(w, "Authentication error: Invalid email or mail token", http.StatusForbidden)
-		               return
-		          }
-		 	retryCount := 0
-		 	for retryCount < sendMailRetryCount {
-		 		log.Printf("Retrying to send email to %s, attempt %d", receiver.Email, retryCount+1)
-		 		err = sendEmail(from, mailToken, &receiver)
-		 		if err == nil {
-		 			log.Printf("Email sent successfully to %s", receiver.Email)
-		 			break
-		 		}
-		 		retryCount++
-		 	}
-		 	if retryCount == sendMailRetryCount {
-		 		log.Printf("Failed to send email to %s after %d attempts: %v", receiver.Email, sendMailRetryCount, err)
-		 		failedReceivers = append(failedReceivers, receiver)
-		 		continue
-		 	}
-		 }
-		 if err == nil {
-		 	log.Printf("Email sent successfully to %s", receiver.Email)
-		 	successReceivers = append(successReceivers, receiver)
-		 }
-	}
-
-	// Prepare response
-	response := MailResponse{
-		Success: successReceivers,
-		Failed:  failedReceivers,
+	total := len(mailReq.Data)
+	if mailReq.Data, err = model.FilterReceivers(mailReq.Data, mailReq.Filters); err != nil {
+		http.Error(w, "Invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Every receiver needs its own attachment before anything is sent
+	if config.ReceiverAttachments != nil {
+		if errors := config.ReceiverAttachments.CheckReceivers(mailReq.Data); len(errors) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(SendPrecheckResponse{
+				Success: false,
+				Message: fmt.Sprintf("%d receivers have no matching attachment", len(errors)),
+				Errors:  errors,
+			})
+			return
+		}
+	}
+
+	campaign := model.Campaign{
+		ID:              model.NewID(),
+		TemplateID:      config.ID,
+		TemplateVersion: config.Version,
+		Sender:          from,
+		StartedAt:       time.Now(),
+	}
+
+	// Only the test slice of an A/B test is sent now, the others wait for
+	// the winner
+	receivers := mailReq.Data
+	var held []model.Receiver
+	if config.ABTest != nil {
+		receivers, held = config.ABTest.Split(config.ID, receivers)
+	}
+
+	// Refuse up front instead of failing every receiver after all retries
+	templates := merge.NewCache()
+	prepared, errors := h.prepareMessages(templates, config, from, campaign.ID, receivers, maxPreparedSize)
+	_, heldErrors := h.prepareMessages(templates, config, from, campaign.ID, held, 0)
+	if errors = append(errors, heldErrors...); len(errors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(SendPrecheckResponse{
+			Success: false,
+			Message: fmt.Sprintf("%d receivers have a message that cannot be sent", len(errors)),
+			Errors:  errors,
+		})
+		return
+	}
+
+	if h.transportErr != nil {
+		http.Error(w, "Internal Server Error: Mail transport is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if config.ABTest != nil {
+		campaign.Variants = model.NewCampaignStats(config.ABTest)
+		campaign.Held = len(held)
+		if len(held) > 0 {
+			if err := model.SaveHeldReceivers(campaign.ID, held); err != nil {
+				log.Printf("Error saving held receivers: %v", err)
+				http.Error(w, "Internal Server Error: Failed to save held receivers", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	campaign.Total = len(receivers)
+
+	if err := model.SaveCampaign(&campaign); err != nil {
+		log.Printf("Error recording campaign: %v", err)
+	}
+
+	response, ok := h.deliver(w, mailer.Credentials{Username: from, Password: mailToken}, templates, config, from, &campaign, receivers, prepared)
+	if !ok {
+		return
+	}
+	response.Held = campaign.Held
+	response.Skipped = total - len(mailReq.Data)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+type SendWinnerRequest struct {
+	// Variant names the winner, by default the one with the best click
+	// rate, then open rate. It is required when no opens or clicks were
+	// recorded.
+	Variant string `json:"variant,omitempty"`
+}
+
+// SendWinner sends the winning variant of an A/B test to the receivers held
+// back from the test slice, using the template version of the test.
+func (h *SendMailHandler) SendWinner(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from := userClaims.Username
+	mailToken := userClaims.MailToken
+	if from == "" || mailToken == "" {
+		log.Printf("Missing sender address or mail token in token claims")
+		http.Error(w, "Internal Server Error: Missing email configuration", http.StatusInternalServerError)
+		return
+	}
+
+	var req SendWinnerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := model.GetCampaign(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+	if len(campaign.Variants) == 0 {
+		http.Error(w, "Campaign is not an A/B test", http.StatusBadRequest)
+		return
+	}
+	if campaign.Winner != "" {
+		http.Error(w, "The winner has already been sent", http.StatusConflict)
+		return
+	}
+
+	receivers, err := model.GetHeldReceivers(campaign.ID)
+	if err != nil {
+		log.Printf("Error loading held receivers: %v", err)
+		http.Error(w, "Internal Server Error: Failed to load held receivers", http.StatusInternalServerError)
+		return
+	}
+	if len(receivers) == 0 {
+		http.Error(w, "No receivers are waiting for the winner", http.StatusBadRequest)
+		return
+	}
+
+	winner := req.Variant
+	if winner == "" {
+		if winner = campaign.BestVariant(); winner == "" {
+			http.Error(w, "The tracking results pick no winner, name the variant to send", http.StatusBadRequest)
+			return
+		}
+	}
+	if campaign.Stats(winner) == nil {
+		http.Error(w, "Unknown or unsent variant", http.StatusBadRequest)
+		return
+	}
+
+	config, err := model.GetTemplateVersion(campaign.TemplateID, campaign.TemplateVersion)
+	if err == nil {
+		config = config.ForWinner(winner)
+	}
+	if config == nil {
+		log.Printf("Error loading template version of campaign %s: %v", campaign.ID, err)
+		http.Error(w, "Template version of the campaign not found", http.StatusBadRequest)
+		return
+	}
+
+	templates := merge.NewCache()
+	prepared, receiverErrors := h.prepareMessages(templates, config, from, campaign.ID, receivers, maxPreparedSize)
+	if len(receiverErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(SendPrecheckResponse{
+			Success: false,
+			Message: fmt.Sprintf("%d receivers have a message that cannot be sent", len(receiverErrors)),
+			Errors:  receiverErrors,
+		})
+		return
+	}
+
+	if h.transportErr != nil {
+		http.Error(w, "Internal Server Error: Mail transport is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	// Claiming the winner first keeps a second request from sending again
+	campaign, err = model.ClaimWinner(campaign.ID, winner, len(receivers))
+	if errors.Is(err, model.ErrWinnerSent) {
+		http.Error(w, "The winner has already been sent", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error recording campaign: %v", err)
+		http.Error(w, "Internal Server Error: Failed to record campaign", http.StatusInternalServerError)
+		return
+	}
+	if err := model.DeleteHeldReceivers(campaign.ID); err != nil {
+		log.Printf("Error deleting held receivers: %v", err)
+	}
+
+	response, ok := h.deliver(w, mailer.Credentials{Username: from, Password: mailToken}, templates, config, from, campaign, receivers, prepared)
+	if !ok {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -107,10 +341,135 @@ func (h *SendMailHandler) SendEmail(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func addAttachmentsToMessage(m *mail.Message, attachments []model.Attachment) error {
-	var attachmentDir = filepath.Join(os.TempDir(), "email_configs", "email_attachments")
+// deliver sends the message of every receiver and records the results in
+// the campaign. prepared holds the messages already built by the precheck,
+// indexed like receivers. On an authentication error it writes the error
+// response and returns false.
+func (h *SendMailHandler) deliver(w http.ResponseWriter, auth mailer.Credentials, templates *merge.Cache, config *model.EmailConfig, from string, campaign *model.Campaign, receivers []model.Receiver, prepared []*mailer.Message) (*MailResponse, bool) {
+	jobID := campaign.ID
+	h.webhooks.Dispatch(webhook.EventJobStarted, webhook.JobPayload{
+		JobID:           jobID,
+		TemplateID:      config.ID,
+		TemplateVersion: config.Version,
+		Total:           len(receivers),
+	})
+
+	// Initialize response lists
+	var successReceivers []model.Receiver
+	var failedReceivers []model.Receiver
+	locales := make(map[string]string)
+	variants := make(map[string]string)
+
+	for i, receiver := range receivers {
+		_, locale := config.ForReceiver(&receiver)
+		locales[receiver.ID] = locale
+		variant, token := h.trackingToken(config, campaign.ID, &receiver)
+		if variant != "" {
+			variants[receiver.ID] = variant
+		}
+
+		// The message is built once, retries send it again as is
+		var m *mailer.Message
+		var err error
+		if i < len(prepared) && prepared[i] != nil {
+			m = prepared[i]
+			prepared[i] = nil
+		} else {
+			m, _, err = h.buildMessage(templates, config, from, &receiver, token)
+		}
+
+		attempts := 1
+		if err == nil {
+			err = h.sendEmail(auth, m)
+		}
+		// A message that cannot be built fails the same way on every retry
+		if err != nil && m != nil {
+			fmt.Println("Error: ", err.Error())
+			if strings.Contains(err.Error(), "Username and Password not accepted") {
+				log.Printf("Authentication error: %v", err)
+				h.completeCampaign(campaign, "authentication error: invalid email or mail token")
+				h.webhooks.Dispatch(webhook.EventJobCompleted, webhook.JobPayload{
+					JobID:     jobID,
+					Total:     len(receivers),
+					Succeeded: len(successReceivers),
+					Failed:    len(failedReceivers),
+					Error:     "authentication error: invalid email or mail token",
+				})
+				http.Error(w, "Authentication error: Invalid email or mail token", http.StatusForbidden)
+				return nil, false
+			}
+			// A permanent rejection will not succeed on retry
+			for attempts <= sendMailRetryCount && !mailer.IsPermanent(err) {
+				log.Printf("Retrying to send email to %s, attempt %d", receiver.Email, attempts)
+				err = h.sendEmail(auth, m)
+				attempts++
+				if err == nil {
+					break
+				}
+			}
+		}
+
+		payload := webhook.ReceiverPayload{
+			JobID:    jobID,
+			Receiver: receiver,
+			Locale:   locale,
+			Variant:  variant,
+			Attempts: attempts,
+		}
+		stats := campaign.Stats(variant)
+		if err != nil {
+			log.Printf("Failed to send email to %s after %d attempts: %v", receiver.Email, attempts, err)
+			failedReceivers = append(failedReceivers, receiver)
+			payload.Error = err.Error()
+			campaign.Failed++
+			if stats != nil {
+				stats.Failed++
+				if mailer.IsRejected(err) {
+					stats.Bounced++
+				}
+			}
+		} else {
+			log.Printf("Email sent successfully to %s", receiver.Email)
+			successReceivers = append(successReceivers, receiver)
+			campaign.Succeeded++
+			if stats != nil {
+				stats.Sent++
+			}
+		}
+		h.webhooks.Dispatch(webhook.ReceiverEvent(err), payload)
+	}
 
-	for _, attachment := range attachments {
+	h.completeCampaign(campaign, "")
+	h.webhooks.Dispatch(webhook.EventJobCompleted, webhook.JobPayload{
+		JobID:     jobID,
+		Total:     len(receivers),
+		Succeeded: len(successReceivers),
+		Failed:    len(failedReceivers),
+	})
+
+	return &MailResponse{
+		JobID:           jobID,
+		TemplateID:      config.ID,
+		TemplateVersion: config.Version,
+		Success:         successReceivers,
+		Failed:          failedReceivers,
+		Locales:         locales,
+		Variants:        variants,
+	}, true
+}
+
+func (h *SendMailHandler) completeCampaign(campaign *model.Campaign, message string) {
+	campaign.Error = message
+	campaign.CompletedAt = time.Now()
+	if err := h.saveCampaign(campaign); err != nil {
+		log.Printf("Error recording campaign: %v", err)
+	}
+}
+
+func addAttachmentsToMessage(m *mailer.Message, config *model.EmailConfig, receiver *model.Receiver) error {
+	attachmentDir := config.AttachmentDir()
+
+	for _, attachment := range config.Attachments {
 		attachmentPath := filepath.Join(attachmentDir, attachment.Name)
 
 		// Check if attachment file exists
@@ -140,59 +499,223 @@ func addAttachmentsToMessage(m *mail.Message, attachments []model.Attachment) er
 			}
 		}
 
-		m.Attach(attachmentPath)
+		if attachment.Inline {
+			m.AttachInline(attachment.Name, attachment.Type, attachment.ContentID, data)
+		} else {
+			m.Attach(attachment.Name, attachment.Type, data)
+		}
+	}
+
+	// Unlike the shared attachments, a missing receiver file fails the mail
+	if config.ReceiverAttachments != nil {
+		paths, err := config.ReceiverAttachments.Match(receiver)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read attachment %s: %w", filepath.Base(path), err)
+			}
+			m.Attach(filepath.Base(path), mime.TypeByExtension(filepath.Ext(path)), data)
+		}
 	}
 
 	return nil
 }
 
-func sendEmail(from, mailToken string, receiver *model.Receiver) error {
-	// Load the saved email configuration
-	config, err := model.GetLatestEmailConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load email configuration: %w", err)
+// setBody sets the message body according to the content type. HTML and
+// Markdown are sent as multipart/alternative with a generated plain text
+// part.
+func setBody(m *mailer.Message, config *model.EmailConfig, body string, md *markdown.Renderer) error {
+	switch {
+	case config.IsMarkdown():
+		htmlBody, textBody, err := md.Render(m.Subject, body)
+		if err != nil {
+			return err
+		}
+		m.HTMLBody = htmlBody
+		m.TextBody = textBody
+	case config.IsHTML():
+		m.HTMLBody = body
+		m.TextBody = mailer.HTMLToText(body)
+	default:
+		m.TextBody = body
 	}
+	return nil
+}
 
-	m := mail.NewMessage()
-	m.SetHeader("From", from)
-	m.SetHeader("To", receiver.Email)
-	m.SetHeader("Subject", config.Subject)
+// addFooter appends the campaign footer, or the sender's own footer when
+// the campaign has none.
+func addFooter(m *mailer.Message, config *model.EmailConfig, from string) error {
+	footer := config.Footer
+	if footer.IsEmpty() {
+		userFooter, err := model.GetUserFooter(from)
+		if err != nil {
+			return fmt.Errorf("failed to load footer: %w", err)
+		}
+		footer = userFooter
+	}
+	if footer.IsEmpty() {
+		return nil
+	}
 
-	// Get current UTC time in specified format
-	currentTime := time.Now().UTC().Format("2006-01-02 15:04:05")
-	userName := "tri-le_opswat" // Using the specific user login
+	htmlFooter, textFooter, err := footer.Render(footer.Data(from, time.Now()))
+	if err != nil {
+		return err
+	}
 
-	// Check if body contains HTML tags (basic check)
-	isHTML := strings.Contains(config.Body, "<") && strings.Contains(config.Body, ">")
+	if m.HTMLBody != "" {
+		// Keep the footer inside the document when the body is a full page
+		if idx := strings.LastIndex(strings.ToLower(m.HTMLBody), "</body>"); idx != -1 {
+			m.HTMLBody = m.HTMLBody[:idx] + htmlFooter + m.HTMLBody[idx:]
+		} else {
+			m.HTMLBody += "\n" + htmlFooter
+		}
+	}
+	if textFooter == "" && footer.HTML != "" {
+		textFooter = mailer.HTMLToText(htmlFooter)
+	}
+	if m.TextBody != "" && textFooter != "" {
+		m.TextBody += "\n\n" + textFooter
+	}
+	return nil
+}
 
-	if isHTML {
-		// Set HTML body with footer
-		htmlBody := fmt.Sprintf("%s",
-			config.Body)
-		m.SetBody("text/html", htmlBody)
-	} else {
-		// Set plain text body with footer
-		plainBody := fmt.Sprintf("%s\n\n"+
-			"----------------------------------------\n"+
-			"Current Date and Time (UTC): %s\n"+
-			"Current User's Login: %s",
-			config.Body, currentTime, userName)
-		m.SetBody("text/plain", plainBody)
+// prepareMessages builds the message of every receiver and reports the
+// ones that fail to render, are over the size budget or cannot be signed or
+// encrypted. When nothing differs per receiver apart from the address,
+// checking the first one is enough. The built messages are returned
+// indexed like receivers for deliver to send, as long as their total size
+// stays within budget.
+func (h *SendMailHandler) prepareMessages(templates *merge.Cache, config *model.EmailConfig, from, campaignID string, receivers []model.Receiver, budget int64) ([]*mailer.Message, []model.ReceiverError) {
+	perReceiver := config.ReceiverAttachments != nil || len(config.Documents) > 0 ||
+		len(messageProcessors(config)) > 0 || merge.IsTemplate(config) || len(config.Locales) > 0 ||
+		config.ABTest != nil
+	checked := receivers
+	if !perReceiver && len(checked) > 1 {
+		checked = checked[:1]
 	}
 
-	// Add attachments from saved configuration
-	if len(config.Attachments) > 0 {
-		if err := addAttachmentsToMessage(m, config.Attachments); err != nil {
-			log.Printf("Warning: Failed to add some attachments: %v", err)
+	prepared := make([]*mailer.Message, len(receivers))
+	var errors []model.ReceiverError
+	for i := range checked {
+		_, token := h.trackingToken(config, campaignID, &checked[i])
+		m, size, err := h.buildMessage(templates, config, from, &checked[i], token)
+		if err != nil {
+			errors = append(errors, model.NewReceiverError(&checked[i], err.Error()))
+			continue
+		}
+		if size <= budget {
+			prepared[i] = m
+			budget -= size
 		}
 	}
+	return prepared, errors
+}
 
-	// Create dialer for SMTP connection
-	d := mail.NewDialer("smtp.gmail.com", 587, from, mailToken)
-	err = d.DialAndSend(m)
+// trackingToken returns the A/B variant of the receiver and, when tracking
+// is enabled, the token identifying it in the tracking links.
+func (h *SendMailHandler) trackingToken(config *model.EmailConfig, campaignID string, receiver *model.Receiver) (string, string) {
+	_, variant := config.ForABTest(receiver)
+	if variant == "" || !h.tracker.Enabled() {
+		return variant, ""
+	}
+	return variant, h.tracker.Token(tracking.Recipient{CampaignID: campaignID, Variant: variant, Email: receiver.Email})
+}
+
+func (h *SendMailHandler) sendEmail(auth mailer.Credentials, m *mailer.Message) error {
+	err := h.transport.Send(m, auth)
 	if err != nil {
 		fmt.Printf("Failed to send email: %v\n", err)
-		return fmt.Errorf("failed to send email: %w", err)
+		return fmt.Errorf("failed to send email via %s: %w", h.transport.Name(), err)
 	}
 	return nil
 }
+
+// buildMessage renders the message for one receiver and checks it against
+// the size budget, returning its encoded size. Templates are parsed through
+// the job's cache. A tracking token adds open and click tracking to HTML
+// bodies.
+func (h *SendMailHandler) buildMessage(templates *merge.Cache, config *model.EmailConfig, from string, receiver *model.Receiver, token string) (*mailer.Message, int64, error) {
+	config, _ = config.ForReceiver(receiver)
+	config, _ = config.ForABTest(receiver)
+
+	tmpl, err := templates.Parse(config)
+	if err != nil {
+		return nil, 0, err
+	}
+	subject, body, err := tmpl.Execute(receiver)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	m := &mailer.Message{
+		From:    from,
+		To:      []string{receiver.Email},
+		Subject: subject,
+	}
+
+	if err := setBody(m, config, body, h.markdown); err != nil {
+		return nil, 0, err
+	}
+
+	if err := addFooter(m, config, from); err != nil {
+		return nil, 0, err
+	}
+	// Mail clients drop or ignore much of the CSS in <style> blocks
+	if m.HTMLBody != "" {
+		inlined, err := css.Inline(m.HTMLBody)
+		if err != nil {
+			return nil, 0, err
+		}
+		m.HTMLBody = inlined.HTML
+	}
+	if token != "" && m.HTMLBody != "" {
+		m.HTMLBody = h.tracker.Instrument(m.HTMLBody, token)
+	}
+
+	// Add attachments from saved configuration
+	if err := addAttachmentsToMessage(m, config, receiver); err != nil {
+		return nil, 0, fmt.Errorf("failed to add attachments: %w", err)
+	}
+	for i := range config.Documents {
+		doc := &config.Documents[i]
+		data, err := h.documents.Render(doc, receiver, config.Location())
+		if err != nil {
+			return nil, 0, err
+		}
+		m.Attach(doc.FileNameFor(receiver), "application/pdf", data)
+	}
+	m.LinkInlineImages()
+
+	size, err := m.FitSize(h.config.MaxMessageSize, config.ZipOversizedAttachments)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Signing and encryption come last since they freeze the message
+	processors := messageProcessors(config)
+	for _, processor := range processors {
+		if err := processor.Process(m); err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(processors) > 0 {
+		if size, err = m.FitSize(h.config.MaxMessageSize, false); err != nil {
+			return nil, 0, err
+		}
+	}
+	return m, size, nil
+}
+
+func messageProcessors(config *model.EmailConfig) []mailer.Processor {
+	var processors []mailer.Processor
+	if config.SMIME != nil && (config.SMIME.Sign || config.SMIME.Encrypt) {
+		processors = append(processors, smime.NewProcessor(*config.SMIME))
+	}
+	if config.PGPPolicy == model.PGPPolicyPrefer || config.PGPPolicy == model.PGPPolicyRequire {
+		processors = append(processors, pgp.NewProcessor(config.PGPPolicy))
+	}
+	return processors
+}
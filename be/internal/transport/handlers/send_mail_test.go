@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lambertse/cquan_go_webapp/internal/config"
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/markdown"
+	"github.com/lambertse/cquan_go_webapp/internal/merge"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+// recordingTransport keeps the messages it is asked to send.
+type recordingTransport struct {
+	sent []*mailer.Message
+}
+
+func (t *recordingTransport) Name() string { return "test" }
+
+func (t *recordingTransport) Send(m *mailer.Message, auth mailer.Credentials) error {
+	t.sent = append(t.sent, m)
+	return nil
+}
+
+func TestDeliverWinner(t *testing.T) {
+	transport := &recordingTransport{}
+	var saved []model.Campaign
+	h := &SendMailHandler{
+		config:    &config.AppConfig{},
+		markdown:  markdown.NewRenderer(""),
+		transport: transport,
+		saveCampaign: func(campaign *model.Campaign) error {
+			saved = append(saved, *campaign)
+			return nil
+		},
+	}
+
+	template := &model.EmailConfig{
+		ID:          "template",
+		Subject:     "Hello",
+		Body:        "Body",
+		ContentType: model.ContentTypeText,
+		Footer:      &model.Footer{Text: "Regards"},
+		ABTest: &model.ABTest{
+			Variants: []model.ABVariant{
+				{Name: "A", Percent: 50, Subject: "Subject A"},
+				{Name: "B", Percent: 50, Subject: "Subject B"},
+			},
+			TestPercent: 20,
+		},
+	}
+	campaign := &model.Campaign{ID: "campaign", Variants: model.NewCampaignStats(template.ABTest)}
+	campaign.Stats("A").Sent = 3
+	campaign.Stats("B").Sent = 4
+
+	var receivers []model.Receiver
+	for i := 0; i < 20; i++ {
+		receivers = append(receivers, model.Receiver{ID: fmt.Sprint(i + 2), Email: fmt.Sprintf("user%d@example.com", i)})
+	}
+
+	config := template.ForWinner("B")
+	if config == nil {
+		t.Fatal("ForWinner returned nil for a known variant")
+	}
+	templates := merge.NewCache()
+	prepared, receiverErrors := h.prepareMessages(templates, config, "sender@example.com", campaign.ID, receivers, maxPreparedSize)
+	if len(receiverErrors) > 0 {
+		t.Fatalf("prepareMessages: %v", receiverErrors)
+	}
+	response, ok := h.deliver(httptest.NewRecorder(), mailer.Credentials{}, templates, config, "sender@example.com", campaign, receivers, prepared)
+	if !ok {
+		t.Fatal("deliver failed")
+	}
+
+	if got := campaign.Stats("B").Sent; got != 4+len(receivers) {
+		t.Errorf("variant B sent = %d, want %d", got, 4+len(receivers))
+	}
+	if got := campaign.Stats("A").Sent; got != 3 {
+		t.Errorf("variant A sent = %d, want 3", got)
+	}
+	if len(saved) != 1 || saved[0].Stats("B").Sent != 4+len(receivers) {
+		t.Errorf("saved campaigns = %+v, want one with the winner counted", saved)
+	}
+	if len(transport.sent) != len(receivers) {
+		t.Fatalf("sent %d messages, want %d", len(transport.sent), len(receivers))
+	}
+	for _, m := range transport.sent {
+		if m.Subject != "Subject B" {
+			t.Errorf("message to %v has subject %q, want %q", m.To, m.Subject, "Subject B")
+		}
+	}
+	for _, receiver := range receivers {
+		if variant := response.Variants[receiver.ID]; variant != "B" {
+			t.Errorf("receiver %s reported as variant %q, want %q", receiver.ID, variant, "B")
+		}
+	}
+
+	if template.ForWinner("C") != nil {
+		t.Error("ForWinner returned a config for an unknown variant")
+	}
+}
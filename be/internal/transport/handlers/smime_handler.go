@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+type SMIMEHandler struct{}
+
+type SMIMEIdentityRequest struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+type SMIMEResponse struct {
+	Success      bool                     `json:"success"`
+	Message      string                   `json:"message"`
+	Identity     *model.SMIMECertificate  `json:"identity,omitempty"`
+	Certificates []model.SMIMECertificate `json:"certificates,omitempty"`
+}
+
+func NewSMIMEHandler() *SMIMEHandler {
+	return &SMIMEHandler{}
+}
+
+func writeSMIMEResponse(w http.ResponseWriter, status int, response SMIMEResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SaveIdentity stores the PEM encoded signing certificate and key of the
+// logged in user.
+func (h *SMIMEHandler) SaveIdentity(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SMIMEIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{Message: "Invalid JSON format"})
+		return
+	}
+
+	identity, err := model.SaveSMIMEIdentity(userClaims.Username, []byte(req.Certificate), []byte(req.PrivateKey))
+	if err != nil {
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{Message: err.Error()})
+		return
+	}
+
+	writeSMIMEResponse(w, http.StatusOK, SMIMEResponse{
+		Success:  true,
+		Message:  "S/MIME identity saved successfully",
+		Identity: identity,
+	})
+}
+
+func (h *SMIMEHandler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	userClaims, err := GetUserFromRequest(r)
+	if err != nil {
+		log.Printf("Error extracting user from token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := model.DeleteSMIMEIdentity(userClaims.Username); err != nil {
+		writeSMIMEResponse(w, http.StatusInternalServerError, SMIMEResponse{Message: err.Error()})
+		return
+	}
+
+	writeSMIMEResponse(w, http.StatusOK, SMIMEResponse{
+		Success: true,
+		Message: "S/MIME identity deleted successfully",
+	})
+}
+
+// SaveCertificates adds the receiver certificates of an uploaded PEM file
+// to the certificate store.
+func (h *SMIMEHandler) SaveCertificates(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Error parsing multipart form: %v", err)
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{Message: "Unable to parse form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error retrieving file from form: %v", err)
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{Message: "Unable to retrieve file"})
+		return
+	}
+	defer file.Close()
+
+	bundle, err := io.ReadAll(file)
+	if err != nil {
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{Message: "Unable to read file"})
+		return
+	}
+
+	certificates, err := model.SaveSMIMECertificates(bundle)
+	if err != nil {
+		writeSMIMEResponse(w, http.StatusBadRequest, SMIMEResponse{
+			Message:      err.Error(),
+			Certificates: certificates,
+		})
+		return
+	}
+
+	writeSMIMEResponse(w, http.StatusOK, SMIMEResponse{
+		Success:      true,
+		Message:      "Certificates saved successfully",
+		Certificates: certificates,
+	})
+}
+
+func (h *SMIMEHandler) ListCertificates(w http.ResponseWriter, r *http.Request) {
+	certificates, err := model.ListSMIMECertificates()
+	if err != nil {
+		writeSMIMEResponse(w, http.StatusInternalServerError, SMIMEResponse{Message: err.Error()})
+		return
+	}
+
+	writeSMIMEResponse(w, http.StatusOK, SMIMEResponse{
+		Success:      true,
+		Message:      "Certificates retrieved successfully",
+		Certificates: certificates,
+	})
+}
+
+func (h *SMIMEHandler) DeleteCertificate(w http.ResponseWriter, r *http.Request) {
+	if err := model.DeleteSMIMECertificate(chi.URLParam(r, "email")); err != nil {
+		writeSMIMEResponse(w, http.StatusNotFound, SMIMEResponse{Message: err.Error()})
+		return
+	}
+
+	writeSMIMEResponse(w, http.StatusOK, SMIMEResponse{
+		Success: true,
+		Message: "Certificate deleted successfully",
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/lambertse/cquan_go_webapp/internal/tracking"
+)
+
+// A transparent 1x1 GIF
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+type TrackingHandler struct {
+	tracker *tracking.Tracker
+}
+
+func NewTrackingHandler(tracker *tracking.Tracker) *TrackingHandler {
+	return &TrackingHandler{tracker: tracker}
+}
+
+// TrackOpen records an open and serves the pixel. The pixel is served even
+// for a bad token so mail clients do not show a broken image.
+func (h *TrackingHandler) TrackOpen(w http.ResponseWriter, r *http.Request) {
+	if recipient, err := h.tracker.Parse(chi.URLParam(r, "token")); err == nil {
+		if err := model.RecordOpen(recipient.CampaignID, recipient.Variant, recipient.Email); err != nil {
+			log.Printf("Error recording open: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.WriteHeader(http.StatusOK)
+	w.Write(trackingPixel)
+}
+
+// TrackClick records a click and redirects to the original link.
+func (h *TrackingHandler) TrackClick(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	target := r.URL.Query().Get("u")
+	if !h.tracker.VerifyClick(token, target, r.URL.Query().Get("s")) {
+		http.Error(w, "Invalid link", http.StatusBadRequest)
+		return
+	}
+
+	if recipient, err := h.tracker.Parse(token); err == nil {
+		if err := model.RecordClick(recipient.CampaignID, recipient.Variant, recipient.Email); err != nil {
+			log.Printf("Error recording click: %v", err)
+		}
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
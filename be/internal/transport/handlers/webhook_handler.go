@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+	"github.com/lambertse/cquan_go_webapp/internal/webhook"
+)
+
+type WebhookHandler struct{}
+
+type WebhookResponse struct {
+	Success    bool                    `json:"success"`
+	Message    string                  `json:"message"`
+	Webhook    *model.Webhook          `json:"webhook,omitempty"`
+	Webhooks   []model.Webhook         `json:"webhooks,omitempty"`
+	Deliveries []model.WebhookDelivery `json:"deliveries,omitempty"`
+}
+
+func NewWebhookHandler() *WebhookHandler {
+	return &WebhookHandler{}
+}
+
+func writeWebhookResponse(w http.ResponseWriter, status int, response WebhookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// WebhookRequest is a webhook as created or updated. The secret is only
+// accepted here and never returned.
+type WebhookRequest struct {
+	model.Webhook
+	// Secret sets the signing secret. On update, leaving it out keeps the
+	// current one and "" removes it.
+	Secret *string `json:"secret"`
+}
+
+func validateWebhook(hook *model.Webhook) string {
+	parsed, err := url.Parse(hook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "A valid http or https URL is required"
+	}
+	for _, event := range hook.Events {
+		known := event == "*"
+		for _, e := range webhook.Events {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "Unknown event: " + event
+		}
+	}
+	return ""
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeWebhookResponse(w, http.StatusBadRequest, WebhookResponse{Message: "Invalid JSON format"})
+		return
+	}
+	hook := req.Webhook
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	}
+	if msg := validateWebhook(&hook); msg != "" {
+		writeWebhookResponse(w, http.StatusBadRequest, WebhookResponse{Message: msg})
+		return
+	}
+
+	hook.ID = ""
+	if err := model.SaveWebhook(&hook); err != nil {
+		writeWebhookResponse(w, http.StatusInternalServerError, WebhookResponse{
+			Message: "Failed to save webhook: " + err.Error(),
+		})
+		return
+	}
+
+	writeWebhookResponse(w, http.StatusCreated, WebhookResponse{
+		Success: true,
+		Message: "Webhook created successfully",
+		Webhook: &hook,
+	})
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeWebhookResponse(w, http.StatusBadRequest, WebhookResponse{Message: "Invalid JSON format"})
+		return
+	}
+	hook := req.Webhook
+	if msg := validateWebhook(&hook); msg != "" {
+		writeWebhookResponse(w, http.StatusBadRequest, WebhookResponse{Message: msg})
+		return
+	}
+
+	hook.ID = chi.URLParam(r, "id")
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	} else if existing, err := model.GetWebhook(hook.ID); err == nil {
+		hook.Secret = existing.Secret
+	}
+	if err := model.SaveWebhook(&hook); err != nil {
+		writeWebhookResponse(w, http.StatusNotFound, WebhookResponse{
+			Message: "Failed to update webhook: " + err.Error(),
+		})
+		return
+	}
+
+	writeWebhookResponse(w, http.StatusOK, WebhookResponse{
+		Success: true,
+		Message: "Webhook updated successfully",
+		Webhook: &hook,
+	})
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := model.ListWebhooks()
+	if err != nil {
+		writeWebhookResponse(w, http.StatusInternalServerError, WebhookResponse{
+			Message: "Failed to retrieve webhooks: " + err.Error(),
+		})
+		return
+	}
+
+	writeWebhookResponse(w, http.StatusOK, WebhookResponse{
+		Success:  true,
+		Message:  "Webhooks retrieved successfully",
+		Webhooks: webhooks,
+	})
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := model.DeleteWebhook(chi.URLParam(r, "id")); err != nil {
+		writeWebhookResponse(w, http.StatusNotFound, WebhookResponse{
+			Message: "Failed to delete webhook: " + err.Error(),
+		})
+		return
+	}
+
+	writeWebhookResponse(w, http.StatusOK, WebhookResponse{
+		Success: true,
+		Message: "Webhook deleted successfully",
+	})
+}
+
+func (h *WebhookHandler) ListFailedDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := model.ListWebhookDeliveries()
+	if err != nil {
+		writeWebhookResponse(w, http.StatusInternalServerError, WebhookResponse{
+			Message: "Failed to retrieve webhook deliveries: " + err.Error(),
+		})
+		return
+	}
+
+	writeWebhookResponse(w, http.StatusOK, WebhookResponse{
+		Success:    true,
+		Message:    "Failed webhook deliveries retrieved successfully",
+		Deliveries: deliveries,
+	})
+}
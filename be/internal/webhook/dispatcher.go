@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+const (
+	EventJobStarted      = "job.started"
+	EventReceiverSent    = "receiver.sent"
+	EventReceiverFailed  = "receiver.failed"
+	EventReceiverBounced = "receiver.bounced"
+	EventJobCompleted    = "job.completed"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = 2 * time.Second
+)
+
+// Events lists every event a webhook can subscribe to.
+var Events = []string{
+	EventJobStarted,
+	EventReceiverSent,
+	EventReceiverFailed,
+	EventReceiverBounced,
+	EventJobCompleted,
+}
+
+type Envelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type JobPayload struct {
+	JobID           string `json:"job_id"`
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+	Total           int    `json:"total"`
+	Succeeded       int    `json:"succeeded,omitempty"`
+	Failed          int    `json:"failed,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+type ReceiverPayload struct {
+	JobID    string         `json:"job_id"`
+	Receiver model.Receiver `json:"receiver"`
+	Locale   string         `json:"locale,omitempty"`
+	Variant  string         `json:"variant,omitempty"`
+	Attempts int            `json:"attempts"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type Dispatcher struct {
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*queue
+}
+
+// queue holds the pending deliveries of one webhook. They are sent one at
+// a time so a receiver sees the events of a job in order, ending with
+// job.completed.
+type queue struct {
+	pending []delivery
+	running bool
+}
+
+type delivery struct {
+	hook  model.Webhook
+	event string
+	body  []byte
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		client:         &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		queues:         make(map[string]*queue),
+	}
+}
+
+// Dispatch queues the event for every enabled webhook subscribed to it.
+// Deliveries happen in the background so sending mail is never blocked.
+func (d *Dispatcher) Dispatch(event string, data interface{}) {
+	if d == nil {
+		return
+	}
+
+	webhooks, err := model.ListWebhooks()
+	if err != nil {
+		log.Printf("Failed to load webhooks: %v", err)
+		return
+	}
+
+	envelope := Envelope{
+		ID:        model.NewID(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to encode webhook payload for %s: %v", event, err)
+		return
+	}
+
+	for _, hook := range webhooks {
+		if !hook.Enabled || !hook.Subscribed(event) {
+			continue
+		}
+		d.enqueue(delivery{hook: hook, event: event, body: body})
+	}
+}
+
+func (d *Dispatcher) enqueue(next delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q, ok := d.queues[next.hook.ID]
+	if !ok {
+		q = &queue{}
+		d.queues[next.hook.ID] = q
+	}
+	q.pending = append(q.pending, next)
+	if !q.running {
+		q.running = true
+		go d.drain(q)
+	}
+}
+
+// drain delivers the queued events in order until the queue is empty.
+func (d *Dispatcher) drain(q *queue) {
+	for {
+		d.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			d.mu.Unlock()
+			return
+		}
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		d.mu.Unlock()
+
+		d.deliver(next.hook, next.event, next.body)
+	}
+}
+
+func (d *Dispatcher) deliver(hook model.Webhook, event string, body []byte) {
+	backoff := d.initialBackoff
+	var statusCode int
+	var err error
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		statusCode, err = d.post(hook, event, body)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Webhook %s delivery of %s failed, attempt %d: %v", hook.URL, event, attempt, err)
+		if attempt < d.maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	delivery := model.WebhookDelivery{
+		WebhookID:  hook.ID,
+		URL:        hook.URL,
+		Event:      event,
+		Payload:    string(body),
+		Attempts:   d.maxAttempts,
+		StatusCode: statusCode,
+		Error:      err.Error(),
+		CreatedAt:  time.Now(),
+	}
+	if err := model.SaveWebhookDelivery(&delivery); err != nil {
+		log.Printf("Failed to record webhook delivery failure: %v", err)
+	}
+}
+
+func (d *Dispatcher) post(hook model.Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, timestamp)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign computes the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers recompute it with the shared secret to verify a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReceiverEvent picks the event to report for a receiver's send result.
+// Only a message the provider refused is a bounce; one that could not be
+// built or sent otherwise failed.
+func ReceiverEvent(err error) string {
+	if err == nil {
+		return EventReceiverSent
+	}
+	if mailer.IsRejected(err) {
+		return EventReceiverBounced
+	}
+	return EventReceiverFailed
+}
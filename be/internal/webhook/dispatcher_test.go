@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lambertse/cquan_go_webapp/internal/mailer"
+	"github.com/lambertse/cquan_go_webapp/internal/model"
+)
+
+func TestDispatcherDeliversInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var failedOnce bool
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), "sha256="+Sign("secret", r.Header.Get(TimestampHeader), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		event := r.Header.Get(EventHeader)
+		// A failed delivery is retried before the next event goes out
+		if event == EventReceiverSent && !failedOnce {
+			failedOnce = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		events = append(events, event)
+		if event == EventJobCompleted {
+			close(done)
+		}
+	}))
+	defer server.Close()
+
+	d := NewDispatcher()
+	d.initialBackoff = time.Millisecond
+	hook := model.Webhook{ID: "hook", URL: server.URL, Secret: "secret", Enabled: true}
+	want := []string{EventJobStarted, EventReceiverSent, EventReceiverFailed, EventJobCompleted}
+	for _, event := range want {
+		d.enqueue(delivery{hook: hook, event: event, body: []byte(`{"event":"` + event + `"}`)})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deliveries did not complete")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", events, want)
+		}
+	}
+}
+
+func TestReceiverEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"sent", nil, EventReceiverSent},
+		{"temporary", io.EOF, EventReceiverFailed},
+		{"rejected", &textproto.Error{Code: 550, Msg: "no such user"}, EventReceiverBounced},
+		{"refused by the API", &mailer.SendError{Transport: "sendgrid", StatusCode: 400}, EventReceiverBounced},
+		{"not built", mailer.Permanent(errors.New("document failed")), EventReceiverFailed},
+		{"too large", &mailer.SizeError{Size: 2, Limit: 1}, EventReceiverFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReceiverEvent(tt.err); got != tt.want {
+				t.Errorf("ReceiverEvent(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
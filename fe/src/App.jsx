@@ -104,7 +104,8 @@ function App() {
           handleLogout()
           return
         }
-        throw new Error(`Upload failed: ${response.statusText}`)
+        const failure = await response.json().catch(() => null)
+        throw new Error(failure?.message || `Upload failed: ${response.statusText}`)
       }
 
       const result = await response.json()
@@ -113,7 +114,7 @@ function App() {
         fileName: file.name,
         timestamp: CURRENT_TIMESTAMP
       })
-      setUserData(result)
+      setUserData(result.receivers)
       setCurrentView('processor') // Navigate to processor view 
     } catch (error) {
       setProcessResult({
@@ -7,7 +7,8 @@ import './EmailConfigForm.css'
 const EmailConfigForm = ({ onSubmit, onClose, initialData }) => {
   const [formData, setFormData] = useState({
     subject: '',
-    body: ''
+    body: '',
+    content_type: 'text/html'
   })
 
   const [attachments, setAttachments] = useState([])
@@ -20,7 +21,9 @@ const EmailConfigForm = ({ onSubmit, onClose, initialData }) => {
     if (initialData) {
       setFormData({
         subject: initialData.subject || '',
-        body: initialData.body || ''
+        body: initialData.body || '',
+        // Keep the saved type; templates stored without one are plain text
+        content_type: initialData.content_type || 'text/plain'
       })
       setAttachments(initialData.attachments || [])
     }
@@ -218,17 +221,40 @@ const EmailConfigForm = ({ onSubmit, onClose, initialData }) => {
                   </svg>
                   Email Body
                 </label>
-                <div className="quill-container">
-                  <ReactQuill
-                    theme="snow"
+                <select
+                  name="content_type"
+                  value={formData.content_type}
+                  onChange={handleInputChange}
+                  className="input-field"
+                >
+                  <option value="text/html">Rich text</option>
+                  <option value="text/markdown">Markdown</option>
+                  <option value="text/plain">Plain text</option>
+                </select>
+                {formData.content_type !== 'text/html' ? (
+                  <textarea
+                    name="body"
                     value={formData.body}
-                    onChange={handleBodyChange}
-                    modules={modules}
-                    formats={formats}
-                    placeholder="Compose your email template..."
-                    className="email-body-editor"
+                    onChange={handleInputChange}
+                    placeholder={formData.content_type === 'text/markdown'
+                      ? 'Write your email in Markdown, e.g. **bold**, [link](https://...), - list item'
+                      : 'Write your email as plain text'}
+                    rows={14}
+                    className="input-field"
                   />
-                </div>
+                ) : (
+                  <div className="quill-container">
+                    <ReactQuill
+                      theme="snow"
+                      value={formData.body}
+                      onChange={handleBodyChange}
+                      modules={modules}
+                      formats={formats}
+                      placeholder="Compose your email template..."
+                      className="email-body-editor"
+                    />
+                  </div>
+                )}
               </div>
 
               <div className="form-group">